@@ -0,0 +1,90 @@
+// Command ratesim replays request traffic through a rate limiter on a virtual clock
+//
+// The trace is either synthetic (constant, poisson or bursty on/off arrivals for
+// many keys) or recorded in a CSV file of "seconds,key[,cost]" lines. A summary
+// goes to stderr and the per-second time series to stdout as CSV or JSON.
+//
+//	ratesim -algo gcra -rate 10 -burst 5 -trace poisson -keys 100 -arrival-rate 12 -duration 1m
+//	ratesim -rate 10 -burst 5 -max-wait 500ms -trace onoff -on 2s -off 8s -format json
+//	ratesim -algo fixed -rate 100 -trace csv -file access.csv
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "ratesim:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("ratesim", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var limiter LimiterConfig
+	fs.StringVar(&limiter.Algorithm, "algo", "tokenbucket", "limiter: "+strings.Join(Algorithms, ", "))
+	fs.IntVar(&limiter.Rate, "rate", 10, "requests allowed per window per key")
+	fs.DurationVar(&limiter.Window, "window", time.Second, "limiter window")
+	fs.IntVar(&limiter.Burst, "burst", 0, "burst size (defaults to rate)")
+	fs.DurationVar(&limiter.MaxWait, "max-wait", 0, "queue requests for up to this long instead of denying (tokenbucket only)")
+
+	var trace TraceConfig
+	fs.StringVar(&trace.Kind, "trace", "poisson", "arrivals: constant, poisson, onoff or csv")
+	fs.IntVar(&trace.Keys, "keys", 10, "number of keys")
+	fs.Float64Var(&trace.Rate, "arrival-rate", 12, "requests per second per key (while on, for onoff)")
+	fs.DurationVar(&trace.Duration, "duration", time.Minute, "trace length")
+	fs.DurationVar(&trace.On, "on", 2*time.Second, "onoff burst length")
+	fs.DurationVar(&trace.Off, "off", 8*time.Second, "onoff quiet length")
+	fs.Int64Var(&trace.Seed, "seed", 1, "random seed")
+
+	file := fs.String("file", "", "recorded trace for -trace csv")
+	format := fs.String("format", "csv", "time series format: csv or json")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	arrivals, err := loadTrace(trace, *file)
+	if err != nil {
+		return err
+	}
+	report, err := Simulate(arrivals, limiter)
+	if err != nil {
+		return err
+	}
+
+	WriteSummary(stderr, report)
+	switch *format {
+	case "csv":
+		return WriteCSV(stdout, report)
+	case "json":
+		return WriteJSON(stdout, report)
+	}
+	return fmt.Errorf("unknown format %q (want csv or json)", *format)
+}
+
+func loadTrace(cfg TraceConfig, file string) ([]Arrival, error) {
+	if cfg.Kind != "csv" {
+		return Generate(cfg)
+	}
+	if file == "" {
+		return nil, errors.New("-trace csv needs -file")
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCSV(f)
+}
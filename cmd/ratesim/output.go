@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteJSON writes the full report as indented JSON
+func WriteJSON(w io.Writer, r *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the per-second time series with a header row
+func WriteCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"second", "arrivals", "admitted", "denied", "queued", "mean_wait_ms"})
+	for _, s := range r.Series {
+		cw.Write([]string{
+			strconv.Itoa(s.Second),
+			strconv.Itoa(s.Arrivals),
+			strconv.Itoa(s.Admitted),
+			strconv.Itoa(s.Denied),
+			strconv.Itoa(s.Queued),
+			strconv.FormatFloat(s.MeanWaitMs, 'f', -1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteSummary writes a human readable summary of the totals
+func WriteSummary(w io.Writer, r *Report) {
+	pct := func(n int) float64 {
+		if r.Arrivals == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(r.Arrivals)
+	}
+	fmt.Fprintf(w, "%s: %d requests from %d keys over %ds\n", r.Algorithm, r.Arrivals, r.Keys, len(r.Series))
+	fmt.Fprintf(w, "  admitted %d (%.1f%%), denied %d (%.1f%%)\n", r.Admitted, pct(r.Admitted), r.Denied, pct(r.Denied))
+	if r.Queued > 0 {
+		fmt.Fprintf(w, "  queued %d: mean %.1fms, p50 %.1fms, p99 %.1fms, max %.1fms\n",
+			r.Queued, r.Latency.MeanMs, r.Latency.P50Ms, r.Latency.P99Ms, r.Latency.MaxMs)
+	}
+}
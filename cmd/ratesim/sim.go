@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// epoch is the virtual start time of every simulation
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// LimiterConfig selects the limiter a trace is replayed through
+type LimiterConfig struct {
+	Algorithm string // tokenbucket, gcra, leaky, fixed, slidinglog or slidingcounter
+	Rate      int
+	Window    time.Duration
+	Burst     int
+
+	// MaxWait > 0 queues denied requests for up to MaxWait instead of rejecting them
+	// Only supported by the tokenbucket algorithm
+	MaxWait time.Duration
+}
+
+// Algorithms lists the accepted LimiterConfig.Algorithm values
+var Algorithms = []string{"tokenbucket", "gcra", "leaky", "fixed", "slidinglog", "slidingcounter"}
+
+// Build the limiter on the given clock
+func (cfg LimiterConfig) build(clock tokenbucket.Clock) (tokenbucket.Limiter, error) {
+	if cfg.Rate <= 0 || cfg.Window <= 0 {
+		return nil, fmt.Errorf("rate and window must be positive")
+	}
+	if cfg.MaxWait > MaxSpan {
+		return nil, fmt.Errorf("max wait %v is longer than %v", cfg.MaxWait, MaxSpan)
+	}
+	if cfg.MaxWait > 0 && cfg.Algorithm != "tokenbucket" {
+		return nil, fmt.Errorf("queueing is only supported by tokenbucket, not %s", cfg.Algorithm)
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Rate
+	}
+	opt := tokenbucket.WithClock(clock)
+	switch cfg.Algorithm {
+	case "tokenbucket":
+		return tokenbucket.NewTokenBucket(cfg.Rate, cfg.Window, burst, opt), nil
+	case "gcra":
+		return tokenbucket.NewGCRA(cfg.Rate, cfg.Window, burst, opt), nil
+	case "leaky":
+		return tokenbucket.NewLeakyBucket(cfg.Rate, cfg.Window, burst, opt), nil
+	case "fixed":
+		return tokenbucket.NewFixedWindow(cfg.Rate, cfg.Window, opt), nil
+	case "slidinglog":
+		return tokenbucket.NewSlidingWindowLog(cfg.Rate, cfg.Window, opt), nil
+	case "slidingcounter":
+		return tokenbucket.NewSlidingWindowCounter(cfg.Rate, cfg.Window, opt), nil
+	}
+	return nil, fmt.Errorf("unknown algorithm %q", cfg.Algorithm)
+}
+
+// Second is one row of the per-second time series
+// Admitted requests are counted in the second they run, which for queued
+// requests is later than the second they arrived in
+type Second struct {
+	Second     int     `json:"second"`
+	Arrivals   int     `json:"arrivals"`
+	Admitted   int     `json:"admitted"`
+	Denied     int     `json:"denied"`
+	Queued     int     `json:"queued"`
+	MeanWaitMs float64 `json:"mean_wait_ms"`
+}
+
+// Latency summarises how long queued requests waited
+type Latency struct {
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// Report is the outcome of a simulation
+type Report struct {
+	Algorithm string   `json:"algorithm"`
+	Arrivals  int      `json:"arrivals"`
+	Admitted  int      `json:"admitted"`
+	Denied    int      `json:"denied"`
+	Queued    int      `json:"queued"`
+	Keys      int      `json:"keys"`
+	Latency   Latency  `json:"latency"`
+	Series    []Second `json:"series"`
+}
+
+// Simulate replays arrivals through the configured limiter on a virtual clock
+// arrivals must be sorted by time and fall within [0, MaxSpan)
+func Simulate(arrivals []Arrival, cfg LimiterConfig) (*Report, error) {
+	for i, a := range arrivals {
+		if a.At < 0 || (i > 0 && a.At < arrivals[i-1].At) {
+			return nil, fmt.Errorf("arrival %d at %v is out of order", i, a.At)
+		}
+		if a.At >= MaxSpan {
+			return nil, fmt.Errorf("arrival %d at %v is past the %v limit", i, a.At, MaxSpan)
+		}
+	}
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter, err := cfg.build(clock)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := limiter.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	report := &Report{Algorithm: cfg.Algorithm, Arrivals: len(arrivals)}
+	keys := make(map[string]struct{})
+	var waits []time.Duration
+	waitSum := make(map[int]time.Duration)
+
+	row := func(at time.Duration) *Second {
+		s := int(at / time.Second)
+		for len(report.Series) <= s {
+			report.Series = append(report.Series, Second{Second: len(report.Series)})
+		}
+		return &report.Series[s]
+	}
+
+	for _, a := range arrivals {
+		clock.Set(epoch.Add(a.At))
+		keys[a.Key] = struct{}{}
+		row(a.At).Arrivals++
+
+		wait, ok := admit(limiter, cfg.MaxWait, a)
+		if !ok {
+			report.Denied++
+			row(a.At).Denied++
+			continue
+		}
+		report.Admitted++
+		ran := row(a.At + wait)
+		ran.Admitted++
+		if wait > 0 {
+			report.Queued++
+			ran.Queued++
+			waits = append(waits, wait)
+			waitSum[ran.Second] += wait
+		}
+	}
+
+	for i := range report.Series {
+		if s := &report.Series[i]; s.Queued > 0 {
+			s.MeanWaitMs = ms(waitSum[s.Second] / time.Duration(s.Queued))
+		}
+	}
+	report.Keys = len(keys)
+	report.Latency = summarise(waits)
+	return report, nil
+}
+
+// Decide one arrival, returning how long it was queued
+func admit(limiter tokenbucket.Limiter, maxWait time.Duration, a Arrival) (time.Duration, bool) {
+	if maxWait <= 0 {
+		return 0, limiter.AllowN(a.Key, a.Cost)
+	}
+	r := limiter.(*tokenbucket.TokenBucket).Reserve(a.Key, a.Cost)
+	if !r.OK() {
+		return 0, false
+	}
+	wait := r.Delay()
+	if wait > maxWait {
+		r.Cancel()
+		return 0, false
+	}
+	return wait, true
+}
+
+func summarise(waits []time.Duration) Latency {
+	if len(waits) == 0 {
+		return Latency{}
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	var sum time.Duration
+	for _, w := range waits {
+		sum += w
+	}
+	return Latency{
+		MeanMs: ms(sum / time.Duration(len(waits))),
+		P50Ms:  ms(percentile(waits, 0.50)),
+		P99Ms:  ms(percentile(waits, 0.99)),
+		MaxMs:  ms(waits[len(waits)-1]),
+	}
+}
+
+// Nearest-rank percentile of sorted values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
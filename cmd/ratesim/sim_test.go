@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulateDeny(t *testing.T) {
+	// 20/s offered against 10/s with a burst of 5: the first second admits
+	// the burst plus refill, later seconds settle at the refill rate
+	arrivals, _ := Generate(TraceConfig{Kind: "constant", Keys: 1, Rate: 20, Duration: 5 * time.Second})
+	for _, algo := range Algorithms {
+		report, err := Simulate(arrivals, LimiterConfig{Algorithm: algo, Rate: 10, Window: time.Second, Burst: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Arrivals != 100 || report.Admitted+report.Denied != 100 {
+			t.Errorf("%s: inconsistent totals %+v", algo, report)
+		}
+		if report.Admitted < 45 || report.Admitted > 60 {
+			t.Errorf("%s: admitted %d, want about 50", algo, report.Admitted)
+		}
+		if report.Queued != 0 {
+			t.Errorf("%s: queued %d without -max-wait", algo, report.Queued)
+		}
+		if len(report.Series) != 5 {
+			t.Errorf("%s: got %d seconds, want 5", algo, len(report.Series))
+		}
+	}
+}
+
+func TestSimulateQueue(t *testing.T) {
+	// Ten requests at once against 10/s with a burst of 5: five run
+	// immediately, the rest queue 100ms apart until they exceed max wait
+	arrivals := make([]Arrival, 10)
+	for i := range arrivals {
+		arrivals[i] = Arrival{Key: "k", Cost: 1}
+	}
+	report, err := Simulate(arrivals, LimiterConfig{
+		Algorithm: "tokenbucket", Rate: 10, Window: time.Second, Burst: 5, MaxWait: 350 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Admitted != 8 || report.Queued != 3 || report.Denied != 2 {
+		t.Fatalf("got admitted=%d queued=%d denied=%d, want 8/3/2", report.Admitted, report.Queued, report.Denied)
+	}
+	if report.Latency.P50Ms != 200 || report.Latency.MaxMs != 300 || report.Latency.MeanMs != 200 {
+		t.Errorf("latency %+v, want p50 200 mean 200 max 300", report.Latency)
+	}
+	// Denied requests would have waited 400ms and 500ms; cancelling them
+	// returns their tokens, so a request at 300ms runs without queueing
+	more := append(arrivals, Arrival{At: 300 * time.Millisecond, Key: "k", Cost: 1})
+	report, _ = Simulate(more, LimiterConfig{
+		Algorithm: "tokenbucket", Rate: 10, Window: time.Second, Burst: 5, MaxWait: 350 * time.Millisecond,
+	})
+	if report.Admitted != 9 {
+		t.Errorf("admitted %d, want 9", report.Admitted)
+	}
+}
+
+func TestSimulateQueueSpillsIntoNextSecond(t *testing.T) {
+	arrivals := []Arrival{
+		{At: 900 * time.Millisecond, Key: "k", Cost: 1},
+		{At: 900 * time.Millisecond, Key: "k", Cost: 1},
+	}
+	report, err := Simulate(arrivals, LimiterConfig{
+		Algorithm: "tokenbucket", Rate: 5, Window: time.Second, Burst: 1, MaxWait: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Series) != 2 {
+		t.Fatalf("got %d seconds, want 2", len(report.Series))
+	}
+	first, second := report.Series[0], report.Series[1]
+	if first.Arrivals != 2 || first.Admitted != 1 || second.Admitted != 1 || second.Queued != 1 {
+		t.Errorf("series %+v", report.Series)
+	}
+	if second.MeanWaitMs != 200 {
+		t.Errorf("mean wait %vms, want 200ms", second.MeanWaitMs)
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	for _, cfg := range []LimiterConfig{
+		{Algorithm: "tokenbucket", Rate: 0, Window: time.Second},
+		{Algorithm: "quantum", Rate: 1, Window: time.Second},
+		{Algorithm: "gcra", Rate: 1, Window: time.Second, MaxWait: time.Second},
+		{Algorithm: "tokenbucket", Rate: 1, Window: time.Second, MaxWait: MaxSpan + time.Second},
+	} {
+		if _, err := Simulate(nil, cfg); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+
+	cfg := LimiterConfig{Algorithm: "tokenbucket", Rate: 1, Window: time.Second}
+	for _, arrivals := range [][]Arrival{
+		{{At: -time.Second, Key: "a", Cost: 1}},
+		{{At: 2 * time.Second, Key: "a", Cost: 1}, {At: time.Second, Key: "a", Cost: 1}},
+		{{At: MaxSpan, Key: "a", Cost: 1}},
+	} {
+		if _, err := Simulate(arrivals, cfg); err == nil {
+			t.Errorf("%+v: expected an error", arrivals)
+		}
+	}
+}
+
+func TestRunCSVTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	if err := os.WriteFile(path, []byte("0,a\n0,a\n0,b\n1.2,a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-rate", "1", "-trace", "csv", "-file", path}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "second,arrivals,admitted,denied,queued,mean_wait_ms\n0,3,2,1,0,0\n1,1,1,0,0,0\n"
+	if stdout.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "admitted 3 (75.0%), denied 1 (25.0%)") {
+		t.Errorf("summary %q", stderr.String())
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-trace", "constant", "-keys", "2", "-arrival-rate", "5", "-duration", "3s", "-format", "json"}
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Arrivals != 30 || report.Admitted != 30 || len(report.Series) != 3 || report.Keys != 2 {
+		t.Errorf("report %+v", report)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-format", "xml"},
+		{"-trace", "csv"},
+		{"-trace", "csv", "-file", filepath.Join(t.TempDir(), "missing.csv")},
+		{"-bogus"},
+	} {
+		if err := run(args, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSpan is the longest trace that can be simulated
+// The report has a row for every second, so the span bounds its size.
+const MaxSpan = 7 * 24 * time.Hour
+
+// Arrival is one request in a trace
+type Arrival struct {
+	At   time.Duration // Offset from the start of the trace
+	Key  string
+	Cost int
+}
+
+// TraceConfig describes a synthetic trace
+type TraceConfig struct {
+	Kind     string        // constant, poisson or onoff
+	Keys     int           // Number of distinct keys
+	Rate     float64       // Requests per second per key (during on periods for onoff)
+	Duration time.Duration // Length of the trace
+	On, Off  time.Duration // onoff period lengths
+	Seed     int64
+}
+
+// Generate a synthetic trace sorted by arrival time
+func Generate(cfg TraceConfig) ([]Arrival, error) {
+	if cfg.Keys <= 0 || !(cfg.Rate > 0) || cfg.Duration <= 0 {
+		return nil, errors.New("keys, rate and duration must be positive")
+	}
+	if cfg.Duration > MaxSpan {
+		return nil, fmt.Errorf("duration %v is longer than %v", cfg.Duration, MaxSpan)
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	interval := time.Duration(float64(time.Second) / cfg.Rate)
+	if interval <= 0 {
+		// The clock has nanosecond resolution, faster arrivals would never advance it
+		return nil, fmt.Errorf("rate %g is above one request per nanosecond", cfg.Rate)
+	}
+
+	var arrivals []Arrival
+	for k := 0; k < cfg.Keys; k++ {
+		key := fmt.Sprintf("key-%d", k)
+		switch cfg.Kind {
+		case "constant":
+			// Stagger keys so they don't all arrive in lockstep
+			offset := interval * time.Duration(k) / time.Duration(cfg.Keys)
+			for at := offset; at < cfg.Duration; at += interval {
+				arrivals = append(arrivals, Arrival{At: at, Key: key, Cost: 1})
+			}
+		case "poisson":
+			for at := exponential(rng, cfg.Rate); at < cfg.Duration; at += exponential(rng, cfg.Rate) {
+				arrivals = append(arrivals, Arrival{At: at, Key: key, Cost: 1})
+			}
+		case "onoff":
+			if cfg.On <= 0 || cfg.Off < 0 {
+				return nil, errors.New("onoff needs a positive on period")
+			}
+			cycle := cfg.On + cfg.Off
+			for at := exponential(rng, cfg.Rate); at < cfg.Duration; at += exponential(rng, cfg.Rate) {
+				if phase := at % cycle; phase >= cfg.On {
+					// Skip the off period, restart at the next on period
+					at += cycle - phase
+					if at >= cfg.Duration {
+						break
+					}
+				}
+				arrivals = append(arrivals, Arrival{At: at, Key: key, Cost: 1})
+			}
+		default:
+			return nil, fmt.Errorf("unknown trace %q (want constant, poisson, onoff or csv)", cfg.Kind)
+		}
+	}
+	sortArrivals(arrivals)
+	return arrivals, nil
+}
+
+// Time to the next arrival of a Poisson process with the given rate per second
+func exponential(rng *rand.Rand, rate float64) time.Duration {
+	return time.Duration(rng.ExpFloat64() / rate * float64(time.Second))
+}
+
+// ReadCSV reads a recorded trace of "seconds,key[,cost]" lines
+// seconds is the offset from the start of the trace, e.g. 0.25. A header
+// line is skipped. Lines need not be sorted.
+func ReadCSV(r io.Reader) ([]Arrival, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var arrivals []Arrival
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: want seconds,key[,cost]", line)
+		}
+		seconds, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			if line == 1 {
+				continue // Header
+			}
+			return nil, fmt.Errorf("line %d: bad offset %q", line, record[0])
+		}
+		// NaN fails both comparisons
+		if !(seconds >= 0 && seconds < MaxSpan.Seconds()) {
+			return nil, fmt.Errorf("line %d: offset %q out of range", line, record[0])
+		}
+		cost := 1
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			if cost, err = strconv.Atoi(record[2]); err != nil || cost < 0 {
+				return nil, fmt.Errorf("line %d: bad cost %q", line, record[2])
+			}
+		}
+		arrivals = append(arrivals, Arrival{
+			At:   time.Duration(seconds * float64(time.Second)),
+			Key:  record[1],
+			Cost: cost,
+		})
+	}
+	sortArrivals(arrivals)
+	return arrivals, nil
+}
+
+func sortArrivals(arrivals []Arrival) {
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		return arrivals[i].At < arrivals[j].At
+	})
+}
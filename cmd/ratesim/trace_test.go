@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateConstant(t *testing.T) {
+	arrivals, err := Generate(TraceConfig{Kind: "constant", Keys: 4, Rate: 10, Duration: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arrivals) != 80 {
+		t.Fatalf("got %d arrivals, want 80", len(arrivals))
+	}
+	// Keys are staggered across the interval rather than arriving together
+	for i, want := range []time.Duration{0, 25 * time.Millisecond, 50 * time.Millisecond, 75 * time.Millisecond} {
+		if arrivals[i].At != want {
+			t.Errorf("arrival %d at %v, want %v", i, arrivals[i].At, want)
+		}
+	}
+}
+
+func TestGeneratePoissonRate(t *testing.T) {
+	cfg := TraceConfig{Kind: "poisson", Keys: 10, Rate: 20, Duration: time.Minute, Seed: 7}
+	arrivals, err := Generate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 10 * 20 * 60.0
+	if got := float64(len(arrivals)); math.Abs(got-want)/want > 0.05 {
+		t.Errorf("got %v arrivals, want about %v", got, want)
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if arrivals[i].At < arrivals[i-1].At {
+			t.Fatalf("arrivals not sorted at %d", i)
+		}
+	}
+
+	again, _ := Generate(cfg)
+	if !reflect.DeepEqual(arrivals, again) {
+		t.Error("same seed produced a different trace")
+	}
+}
+
+func TestGenerateOnOff(t *testing.T) {
+	arrivals, err := Generate(TraceConfig{
+		Kind: "onoff", Keys: 5, Rate: 50, Duration: 30 * time.Second,
+		On: time.Second, Off: 4 * time.Second, Seed: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arrivals) == 0 {
+		t.Fatal("no arrivals")
+	}
+	for _, a := range arrivals {
+		if phase := a.At % (5 * time.Second); phase >= time.Second {
+			t.Fatalf("arrival at %v falls in an off period", a.At)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, cfg := range []TraceConfig{
+		{Kind: "constant", Keys: 0, Rate: 1, Duration: time.Second},
+		{Kind: "constant", Keys: 1, Rate: 0, Duration: time.Second},
+		{Kind: "constant", Keys: 1, Rate: math.NaN(), Duration: time.Second},
+		{Kind: "constant", Keys: 1, Rate: math.Inf(1), Duration: time.Second},
+		{Kind: "constant", Keys: 1, Rate: 2e9, Duration: time.Second},
+		{Kind: "poisson", Keys: 1, Rate: 2e9, Duration: time.Second},
+		{Kind: "constant", Keys: 1, Rate: 1, Duration: MaxSpan + time.Second},
+		{Kind: "onoff", Keys: 1, Rate: 1, Duration: time.Second},
+		{Kind: "zipf", Keys: 1, Rate: 1, Duration: time.Second},
+	} {
+		if _, err := Generate(cfg); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := "seconds,key,cost\n1.5,bob\n0.25,alice,3\n0.5, alice,\n"
+	arrivals, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Arrival{
+		{At: 250 * time.Millisecond, Key: "alice", Cost: 3},
+		{At: 500 * time.Millisecond, Key: "alice", Cost: 1},
+		{At: 1500 * time.Millisecond, Key: "bob", Cost: 1},
+	}
+	if !reflect.DeepEqual(arrivals, want) {
+		t.Errorf("got %+v, want %+v", arrivals, want)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	for _, input := range []string{
+		"0.1\n",
+		"0.1,a\nsoon,b\n",
+		"0.1,a,-1\n",
+		"0.1,a,lots\n",
+		"0.1,a\n-2,b\n",
+		"0.1,a\nNaN,b\n",
+		"0.1,a\n+Inf,b\n",
+		"0.1,a\n1e300,b\n",
+		"0.1,a\n1000000000,b\n",
+	} {
+		if _, err := ReadCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+
+	_, err := ReadCSV(strings.NewReader("seconds,key\n0.1,a\n-2,b\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected an error for line 3, got %v", err)
+	}
+}
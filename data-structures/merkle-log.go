@@ -0,0 +1,264 @@
+package datastructures
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"time"
+)
+
+// MerkleLog is an append-only Merkle tree as used by Certificate Transparency
+// https://datatracker.ietf.org/doc/html/rfc6962#section-2.1
+// Hashing and tree shape are those of NewMerkleTree(data, WithRFC6962()), but
+// leaves are added one at a time and every earlier version of the tree stays
+// provable. A client holding an old signed tree head can check that the log
+// only grew since (consistency proof) and that an entry is in any version of
+// it (inclusion proof), e.g. for an audit trail of validator set changes.
+type MerkleLog struct {
+	// levels[h][i] is the hash of the complete subtree over leaves
+	// [i * 2^h, (i+1) * 2^h); levels[0] holds the leaf hashes
+	levels [][][]byte
+}
+
+// ConsistencyProof shows that the tree of FirstSize leaves is a prefix of the
+// tree of SecondSize leaves
+type ConsistencyProof struct {
+	FirstSize  int
+	SecondSize int
+	FirstRoot  []byte
+	SecondRoot []byte
+	Hashes     [][]byte // RFC 6962 section 2.1.2 consistency proof nodes
+}
+
+// SignedTreeHead is a log's signed commitment to its contents at one size
+type SignedTreeHead struct {
+	TreeSize  int
+	Timestamp time.Time // Millisecond precision, as signed
+	RootHash  []byte
+	Signature []byte // Ed25519 over the RFC 6962 TreeHeadSignature structure
+}
+
+// NewMerkleLog creates an empty log
+func NewMerkleLog() *MerkleLog {
+	return &MerkleLog{levels: [][][]byte{{}}}
+}
+
+// Size returns the number of leaves in the log
+func (l *MerkleLog) Size() int {
+	return len(l.levels[0])
+}
+
+// Append adds data as the next leaf and returns its index
+// Every complete subtree the new leaf finishes is hashed once, so appends
+// cost O(log n) worst case and O(1) amortized.
+// Time: O(log n)
+func (l *MerkleLog) Append(data []byte) int {
+	index := l.Size()
+	l.levels[0] = append(l.levels[0], RFC6962LeafHash(data))
+
+	// While the level ends in a complete pair, hash it into the level above
+	for h := 0; len(l.levels[h])%2 == 0; h++ {
+		if len(l.levels) == h+1 {
+			l.levels = append(l.levels, [][]byte{})
+		}
+		level := l.levels[h]
+		l.levels[h+1] = append(l.levels[h+1], hashChildren(level[len(level)-2], level[len(level)-1]))
+	}
+	return index
+}
+
+// Root returns the root hash of the log at its current size
+func (l *MerkleLog) Root() []byte {
+	return l.subtreeHash(0, l.Size())
+}
+
+// RootAt returns the root hash the log had when it held size leaves
+// Time: O(log n)
+func (l *MerkleLog) RootAt(size int) ([]byte, error) {
+	if size < 0 || l.Size() < size {
+		return nil, errors.New("Tree size out of bounds")
+	}
+	return l.subtreeHash(0, size), nil
+}
+
+// InclusionProof proves that leaf index is in the log as it was at size leaves
+// The proof verifies with VerifyProof(proof, WithRFC6962()) against the root at that size.
+// Time: O(log^2 n)
+func (l *MerkleLog) InclusionProof(index, size int) (*MerkleProof, error) {
+	if size < 0 || l.Size() < size {
+		return nil, errors.New("Tree size out of bounds")
+	}
+	if index < 0 || size <= index {
+		return nil, errors.New("Index out of bounds")
+	}
+	proof := &MerkleProof{
+		Siblings: [][]byte{},
+		PathBits: []bool{},
+		LeafHash: l.levels[0][index],
+		RootHash: l.subtreeHash(0, size),
+	}
+	l.path(proof, index, 0, size)
+	return proof, nil
+}
+
+// Append the audit path of leaf index within leaves [start, end) to proof, leaf first
+// RFC 6962 section 2.1.1
+func (l *MerkleLog) path(proof *MerkleProof, index, start, end int) {
+	if end-start <= 1 {
+		return
+	}
+	mid := start + splitPoint(end-start)
+	if index < mid {
+		l.path(proof, index, start, mid)
+		proof.Siblings = append(proof.Siblings, l.subtreeHash(mid, end))
+		proof.PathBits = append(proof.PathBits, true)
+	} else {
+		l.path(proof, index, mid, end)
+		proof.Siblings = append(proof.Siblings, l.subtreeHash(start, mid))
+		proof.PathBits = append(proof.PathBits, false)
+	}
+}
+
+// ConsistencyProof proves that the log at first leaves is a prefix of the log at second leaves
+// Requires 0 < first <= second <= Size().
+// Time: O(log^2 n)
+func (l *MerkleLog) ConsistencyProof(first, second int) (*ConsistencyProof, error) {
+	if first <= 0 || second < first || l.Size() < second {
+		return nil, errors.New("Tree sizes out of bounds")
+	}
+	proof := &ConsistencyProof{
+		FirstSize:  first,
+		SecondSize: second,
+		FirstRoot:  l.subtreeHash(0, first),
+		SecondRoot: l.subtreeHash(0, second),
+		Hashes:     [][]byte{},
+	}
+	if first < second {
+		l.subproof(proof, first, 0, second, true)
+	}
+	return proof, nil
+}
+
+// SUBPROOF of RFC 6962 section 2.1.2 for the first m leaves of [start, end)
+// complete is true while the subtree of the first m leaves is the one the
+// verifier already knows the hash of (the old root), so it is left out
+func (l *MerkleLog) subproof(proof *ConsistencyProof, m, start, end int, complete bool) {
+	n := end - start
+	if m == n {
+		if !complete {
+			proof.Hashes = append(proof.Hashes, l.subtreeHash(start, end))
+		}
+		return
+	}
+	k := splitPoint(n)
+	if m <= k {
+		l.subproof(proof, m, start, start+k, complete)
+		proof.Hashes = append(proof.Hashes, l.subtreeHash(start+k, end))
+	} else {
+		l.subproof(proof, m-k, start+k, end, false)
+		proof.Hashes = append(proof.Hashes, l.subtreeHash(start, start+k))
+	}
+}
+
+// Hash of the tree over leaves [start, end)
+// Complete aligned subtrees are looked up, others split as RFC 6962 does
+func (l *MerkleLog) subtreeHash(start, end int) []byte {
+	n := end - start
+	if n == 0 {
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	}
+	if n&(n-1) == 0 && start%n == 0 {
+		h := bits.TrailingZeros(uint(n))
+		return l.levels[h][start>>h]
+	}
+	mid := start + splitPoint(n)
+	return hashChildren(l.subtreeHash(start, mid), l.subtreeHash(mid, end))
+}
+
+// VerifyConsistency checks that FirstRoot is the root of a prefix of the tree with SecondRoot
+// RFC 9162 section 2.1.4.2
+// Time: O(log n)
+func VerifyConsistency(proof *ConsistencyProof) bool {
+	if proof == nil || proof.FirstSize <= 0 || proof.SecondSize < proof.FirstSize {
+		return false
+	}
+	if !isHash(proof.FirstRoot) || !isHash(proof.SecondRoot) {
+		return false
+	}
+	for _, hash := range proof.Hashes {
+		if !isHash(hash) {
+			return false
+		}
+	}
+	if proof.FirstSize == proof.SecondSize {
+		return len(proof.Hashes) == 0 && bytes.Equal(proof.FirstRoot, proof.SecondRoot)
+	}
+
+	path := proof.Hashes
+	if proof.FirstSize&(proof.FirstSize-1) == 0 {
+		// The old tree is a complete subtree of the new one, its root is the first node
+		path = append([][]byte{proof.FirstRoot}, path...)
+	}
+	if len(path) == 0 {
+		return false
+	}
+
+	fn, sn := proof.FirstSize-1, proof.SecondSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	// Rebuild both roots: fr from nodes left of the old edge, sr from all of them
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashChildren(c, fr)
+			sr = hashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = hashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, proof.FirstRoot) && bytes.Equal(sr, proof.SecondRoot)
+}
+
+// SignTreeHead signs the log's current size and root with key
+func (l *MerkleLog) SignTreeHead(key ed25519.PrivateKey) *SignedTreeHead {
+	sth := &SignedTreeHead{
+		TreeSize:  l.Size(),
+		Timestamp: time.UnixMilli(time.Now().UnixMilli()),
+		RootHash:  l.Root(),
+	}
+	sth.Signature = ed25519.Sign(key, sth.signedData())
+	return sth
+}
+
+// VerifyTreeHead checks that sth was signed by the log holding key's private half
+func VerifyTreeHead(sth *SignedTreeHead, key ed25519.PublicKey) bool {
+	if sth == nil || sth.TreeSize < 0 || len(sth.RootHash) != sha256.Size {
+		return false
+	}
+	return ed25519.Verify(key, sth.signedData(), sth.Signature)
+}
+
+// The TreeHeadSignature structure of RFC 6962 section 3.5
+// version v1 (0), signature type tree_hash (1), timestamp, tree size and root
+func (sth *SignedTreeHead) signedData() []byte {
+	buf := make([]byte, 0, 2+8+8+sha256.Size)
+	buf = append(buf, 0, 1)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(sth.Timestamp.UnixMilli()))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(sth.TreeSize))
+	return append(buf, sth.RootHash...)
+}
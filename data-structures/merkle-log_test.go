@@ -0,0 +1,316 @@
+package datastructures
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func newTestLog(n int) *MerkleLog {
+	log := NewMerkleLog()
+	for i := 0; i < n; i++ {
+		log.Append([]byte(fmt.Sprintf("entry %d", i)))
+	}
+	return log
+}
+
+func TestMerkleLog_Empty(t *testing.T) {
+	log := NewMerkleLog()
+	if log.Size() != 0 {
+		t.Errorf("Size = %d, want 0", log.Size())
+	}
+	if got := hex.EncodeToString(log.Root()); got != rfc6962Roots[0] {
+		t.Errorf("Empty root = %s, want %s", got, rfc6962Roots[0])
+	}
+}
+
+func TestMerkleLog_RootsMatchRFC6962(t *testing.T) {
+	data := rfc6962Data(t, len(rfc6962Leaves))
+	log := NewMerkleLog()
+	for i, d := range data {
+		if index := log.Append(d); index != i {
+			t.Fatalf("Append returned index %d, want %d", index, i)
+		}
+		if got := hex.EncodeToString(log.Root()); got != rfc6962Roots[i+1] {
+			t.Errorf("Root after %d appends = %s, want %s", i+1, got, rfc6962Roots[i+1])
+		}
+	}
+
+	// Earlier roots stay available
+	for size, want := range rfc6962Roots {
+		root, err := log.RootAt(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(root); got != want {
+			t.Errorf("RootAt(%d) = %s, want %s", size, got, want)
+		}
+	}
+	if _, err := log.RootAt(9); err == nil {
+		t.Error("RootAt beyond the log size should return error")
+	}
+}
+
+func TestMerkleLog_MatchesMerkleTree(t *testing.T) {
+	log := NewMerkleLog()
+	var data [][]byte
+	for n := 1; n <= 70; n++ {
+		d := []byte(fmt.Sprintf("entry %d", n))
+		data = append(data, d)
+		log.Append(d)
+		if tree := NewMerkleTree(data, WithRFC6962()); !bytes.Equal(log.Root(), tree.Root()) {
+			t.Fatalf("Log and tree roots differ at %d leaves", n)
+		}
+	}
+}
+
+func TestMerkleLog_InclusionProofVectors(t *testing.T) {
+	log := NewMerkleLog()
+	for _, d := range rfc6962Data(t, 8) {
+		log.Append(d)
+	}
+
+	// Audit path of leaf 1 in the historical tree of 5 leaves
+	proof, err := log.InclusionProof(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+	}
+	if len(proof.Siblings) != len(want) {
+		t.Fatalf("Siblings count = %d, want %d", len(proof.Siblings), len(want))
+	}
+	for i := range want {
+		if got := hex.EncodeToString(proof.Siblings[i]); got != want[i] {
+			t.Errorf("Sibling %d = %s, want %s", i, got, want[i])
+		}
+	}
+	if hex.EncodeToString(proof.RootHash) != rfc6962Roots[5] || !VerifyProof(proof, WithRFC6962()) {
+		t.Error("Proof should verify against the root at size 5")
+	}
+}
+
+func TestMerkleLog_InclusionProofsAllSizes(t *testing.T) {
+	log := newTestLog(33)
+	for size := 1; size <= log.Size(); size++ {
+		root, _ := log.RootAt(size)
+		for index := 0; index < size; index++ {
+			proof, err := log.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", index, size, err)
+			}
+			if !bytes.Equal(proof.RootHash, root) || !VerifyProof(proof, WithRFC6962()) {
+				t.Errorf("InclusionProof(%d, %d) does not verify", index, size)
+			}
+		}
+	}
+}
+
+func TestMerkleLog_InclusionProofOutOfBounds(t *testing.T) {
+	log := newTestLog(4)
+	for _, c := range [][2]int{{-1, 4}, {4, 4}, {2, 2}, {0, 5}, {0, -1}} {
+		if _, err := log.InclusionProof(c[0], c[1]); err == nil {
+			t.Errorf("InclusionProof(%d, %d) should return error", c[0], c[1])
+		}
+	}
+}
+
+func TestMerkleLog_ConsistencyProofVectors(t *testing.T) {
+	log := NewMerkleLog()
+	for _, d := range rfc6962Data(t, 8) {
+		log.Append(d)
+	}
+
+	tests := []struct {
+		first, second int
+		hashes        []string
+	}{
+		{1, 1, nil},
+		{1, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{6, 8, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 5, []string{
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+	for _, tt := range tests {
+		proof, err := log.ConsistencyProof(tt.first, tt.second)
+		if err != nil {
+			t.Fatalf("ConsistencyProof(%d, %d): %v", tt.first, tt.second, err)
+		}
+		if len(proof.Hashes) != len(tt.hashes) {
+			t.Fatalf("ConsistencyProof(%d, %d) has %d hashes, want %d", tt.first, tt.second, len(proof.Hashes), len(tt.hashes))
+		}
+		for i := range tt.hashes {
+			if got := hex.EncodeToString(proof.Hashes[i]); got != tt.hashes[i] {
+				t.Errorf("ConsistencyProof(%d, %d) hash %d = %s, want %s", tt.first, tt.second, i, got, tt.hashes[i])
+			}
+		}
+		if !VerifyConsistency(proof) {
+			t.Errorf("ConsistencyProof(%d, %d) does not verify", tt.first, tt.second)
+		}
+	}
+}
+
+func TestMerkleLog_ConsistencyProofsAllSizes(t *testing.T) {
+	log := newTestLog(33)
+	for second := 1; second <= log.Size(); second++ {
+		for first := 1; first <= second; first++ {
+			proof, err := log.ConsistencyProof(first, second)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", first, second, err)
+			}
+			if !VerifyConsistency(proof) {
+				t.Errorf("ConsistencyProof(%d, %d) does not verify", first, second)
+			}
+		}
+	}
+}
+
+func TestMerkleLog_ConsistencyProofTampered(t *testing.T) {
+	log := newTestLog(13)
+	forked := newTestLog(5)
+	forked.Append([]byte("rewritten history"))
+	for forked.Size() < 13 {
+		forked.Append([]byte("more"))
+	}
+
+	for first := 1; first < 13; first++ {
+		proof, _ := log.ConsistencyProof(first, 13)
+
+		// Every proof node matters
+		for i := range proof.Hashes {
+			bad := *proof
+			bad.Hashes = append([][]byte{}, proof.Hashes...)
+			bad.Hashes[i] = append([]byte{}, proof.Hashes[i]...)
+			bad.Hashes[i][0] ^= 0xFF
+			if VerifyConsistency(&bad) {
+				t.Errorf("(%d, 13): proof with hash %d flipped verified", first, i)
+			}
+		}
+
+		// A log that rewrote an entry cannot prove consistency with the old root
+		forkedProof, _ := forked.ConsistencyProof(first, 13)
+		forkedProof.FirstRoot, _ = log.RootAt(first)
+		if first > 5 && VerifyConsistency(forkedProof) {
+			t.Errorf("(%d, 13): forked log proved consistency", first)
+		}
+
+		// The proof does not fit a tree of another shape
+		wrongSize := *proof
+		wrongSize.SecondSize = 64
+		if VerifyConsistency(&wrongSize) {
+			t.Errorf("(%d, 13): proof verified with the wrong size", first)
+		}
+	}
+}
+
+func TestMerkleLog_ConsistencyProofOutOfBounds(t *testing.T) {
+	log := newTestLog(4)
+	for _, c := range [][2]int{{0, 4}, {3, 2}, {1, 5}} {
+		if _, err := log.ConsistencyProof(c[0], c[1]); err == nil {
+			t.Errorf("ConsistencyProof(%d, %d) should return error", c[0], c[1])
+		}
+	}
+	if VerifyConsistency(nil) {
+		t.Error("VerifyConsistency(nil) should be false")
+	}
+}
+
+func TestMerkleLog_ConsistencyProofMalformedHashes(t *testing.T) {
+	log := newTestLog(13)
+	proof, _ := log.ConsistencyProof(5, 13)
+	same, _ := log.ConsistencyProof(13, 13)
+
+	tests := map[string]func(p *ConsistencyProof){
+		"short first root": func(p *ConsistencyProof) { p.FirstRoot = p.FirstRoot[:31] },
+		"long second root": func(p *ConsistencyProof) { p.SecondRoot = append(append([]byte{}, p.SecondRoot...), 0) },
+		"long proof hash":  func(p *ConsistencyProof) { p.Hashes[0] = append([]byte{0x01}, p.Hashes[0]...) },
+		"empty proof hash": func(p *ConsistencyProof) { p.Hashes[len(p.Hashes)-1] = nil },
+	}
+	for name, tamper := range tests {
+		bad := *proof
+		bad.Hashes = append([][]byte{}, proof.Hashes...)
+		tamper(&bad)
+		if VerifyConsistency(&bad) {
+			t.Errorf("Proof with %s verified", name)
+		}
+	}
+
+	// Equal sizes compare the roots directly, short ones must still be rejected
+	bad := *same
+	bad.FirstRoot, bad.SecondRoot = []byte{1}, []byte{1}
+	if VerifyConsistency(&bad) {
+		t.Error("Proof between equal sizes with short roots verified")
+	}
+}
+
+func TestMerkleLog_SignedTreeHead(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := newTestLog(10)
+	sth := log.SignTreeHead(priv)
+	if sth.TreeSize != 10 || !bytes.Equal(sth.RootHash, log.Root()) {
+		t.Errorf("Tree head = %d/%x, want 10/%x", sth.TreeSize, sth.RootHash, log.Root())
+	}
+	if !VerifyTreeHead(sth, pub) {
+		t.Fatal("Tree head signature should verify")
+	}
+
+	// Any change to the signed fields breaks the signature
+	bad := *sth
+	bad.TreeSize = 11
+	if VerifyTreeHead(&bad, pub) {
+		t.Error("Tree head with changed size verified")
+	}
+	bad = *sth
+	bad.Timestamp = bad.Timestamp.Add(1)
+	if !VerifyTreeHead(&bad, pub) {
+		// Sub-millisecond precision is not signed
+		t.Error("Tree head with sub-millisecond change should still verify")
+	}
+	bad.Timestamp = sth.Timestamp.Add(1e6)
+	if VerifyTreeHead(&bad, pub) {
+		t.Error("Tree head with changed timestamp verified")
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	if VerifyTreeHead(sth, other) {
+		t.Error("Tree head verified with another log's key")
+	}
+
+	// A client holding the old head checks the log only grew
+	for i := 0; i < 7; i++ {
+		log.Append([]byte("later"))
+	}
+	newer := log.SignTreeHead(priv)
+	proof, err := log.ConsistencyProof(sth.TreeSize, newer.TreeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof.FirstRoot, sth.RootHash) || !bytes.Equal(proof.SecondRoot, newer.RootHash) || !VerifyConsistency(proof) {
+		t.Error("Log should prove consistency between its signed tree heads")
+	}
+}
+
+func BenchmarkMerkleLog_Append(b *testing.B) {
+	log := NewMerkleLog()
+	entry := []byte("validator set change")
+	for i := 0; i < b.N; i++ {
+		log.Append(entry)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"sort"
 )
 
 // MerkleTree implements a binary Merkle tree
@@ -14,8 +15,26 @@ import (
 // - State verification
 // - Light client proofs
 type MerkleTree struct {
-	root   *MerkleNode
-	leaves []*MerkleNode
+	root    *MerkleNode
+	leaves  []*MerkleNode
+	rfc6962 bool // Domain separated hashing and RFC 6962 splitting, see WithRFC6962
+}
+
+// MerkleOption configures how a MerkleTree is built
+type MerkleOption func(*MerkleTree)
+
+// WithRFC6962 builds the tree as specified by RFC 6962 (Certificate Transparency)
+// https://datatracker.ietf.org/doc/html/rfc6962#section-2.1
+//
+// Leaves are hashed as SHA-256(0x00 || data) and interior nodes as
+// SHA-256(0x01 || left || right), so an interior node can never be passed off
+// as a leaf (second preimage attack). Instead of duplicating the last node of
+// an odd level, n leaves are split so the left subtree holds the largest power
+// of two below n, so no two leaf lists share a root (CVE-2012-2459).
+func WithRFC6962() MerkleOption {
+	return func(t *MerkleTree) {
+		t.rfc6962 = true
+	}
 }
 
 // MerkleNode represents a node in the Merkle tree
@@ -37,21 +56,37 @@ type MerkleProof struct {
 }
 
 // NewMerkleTree builds a Merkle tree from a list of data items
+// By default leaves and interior nodes are plain SHA-256 and odd levels
+// duplicate their last node; pass WithRFC6962() for the hardened layout.
 // Time: O(n)
-func NewMerkleTree(data [][]byte) *MerkleTree {
+func NewMerkleTree(data [][]byte, opts ...MerkleOption) *MerkleTree {
 	tree := &MerkleTree{
 		leaves: []*MerkleNode{},
 	}
+	for _, opt := range opts {
+		opt(tree)
+	}
 	if len(data) == 0 {
 		// Edge case: empty data -> return empty or nil
+		if tree.rfc6962 {
+			// RFC 6962 defines the empty tree's hash as SHA-256 of nothing
+			hash := sha256.Sum256(nil)
+			tree.root = &MerkleNode{Hash: hash[:]}
+		}
 		return tree
 	}
 
 	// Hash each data item to create leaves
 	for _, b := range data {
-		hash := sha256.Sum256(b)
+		var hash []byte
+		if tree.rfc6962 {
+			hash = RFC6962LeafHash(b)
+		} else {
+			sum := sha256.Sum256(b)
+			hash = sum[:] // Slice syntax converts [32]byte to []byte
+		}
 		leaf := &MerkleNode{
-			Hash: hash[:], // Slice syntax converts [32]byte to []byte
+			Hash: hash,
 		}
 		tree.leaves = append(tree.leaves, leaf)
 	}
@@ -62,6 +97,11 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 		return tree
 	}
 
+	if tree.rfc6962 {
+		tree.root = buildRFC6962(tree.leaves)
+		return tree
+	}
+
 	// Pair and hash up the tree
 	nextLevel := buildParentLevel(tree.leaves)
 	for 1 < len(nextLevel) {
@@ -82,22 +122,42 @@ func buildParentLevel(children []*MerkleNode) []*MerkleNode {
 		if len(children) <= i+1 {
 			// Handle an odd number of children at the end
 			// Option A: duplicate last node
-			parents = append(parents, buildParent(left, left))
+			parents = append(parents, buildParent(left, left, hashPair))
 			// Option B: promote as-is
 			// parents = append(parents, left)
 		} else {
 			// Normal case
 			right := children[i+1]
-			parents = append(parents, buildParent(left, right))
+			parents = append(parents, buildParent(left, right, hashPair))
 		}
 	}
 	return parents
 }
 
+// Builds the subtree over leaves the way RFC 6962 splits it
+// The left subtree takes the largest power of two strictly below n leaves,
+// the right subtree the rest, so no node is ever duplicated
+func buildRFC6962(leaves []*MerkleNode) *MerkleNode {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return buildParent(buildRFC6962(leaves[:k]), buildRFC6962(leaves[k:]), hashChildren)
+}
+
+// Largest power of two strictly less than n, for n > 1
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
 // Creates a parent of two child nodes
-func buildParent(left, right *MerkleNode) *MerkleNode {
+func buildParent(left, right *MerkleNode, hash func(left, right []byte) []byte) *MerkleNode {
 	parent := &MerkleNode{
-		Hash:  hashPair(left.Hash, right.Hash),
+		Hash:  hash(left.Hash, right.Hash),
 		Left:  left,
 		Right: right,
 	}
@@ -113,6 +173,24 @@ func hashPair(left, right []byte) []byte {
 	return hash[:] // convert [32]byte to []byte
 }
 
+// RFC6962LeafHash returns SHA-256(0x00 || data), the leaf hash of a tree built WithRFC6962
+// Compare it with MerkleProof.LeafHash to check which data a proof is for
+func RFC6962LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Interior node hash of RFC 6962: SHA-256(0x01 || left || right)
+func hashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
 // Root returns the root hash of the tree
 func (t *MerkleTree) Root() []byte {
 	if t.root == nil {
@@ -170,13 +248,27 @@ func (t *MerkleTree) GenerateProof(index int) (*MerkleProof, error) {
 }
 
 // VerifyProof checks if a proof is valid for a given root hash
+// Pass the options the tree was built with, e.g. VerifyProof(proof, WithRFC6962()).
+// The verifier picks the hashing mode: a proof for an RFC 6962 tree never
+// verifies in the default mode or the other way around.
 // Time: O(log n)
-func VerifyProof(proof *MerkleProof) bool {
+func VerifyProof(proof *MerkleProof, opts ...MerkleOption) bool {
 	// Check that the proof is correctly formed
-	if proof == nil || len(proof.LeafHash) == 0 || len(proof.RootHash) == 0 || len(proof.Siblings) != len(proof.PathBits) {
+	if proof == nil || !isHash(proof.LeafHash) || !isHash(proof.RootHash) || len(proof.Siblings) != len(proof.PathBits) {
 		// Error case
 		return false
 	}
+	for _, sib := range proof.Siblings {
+		// Longer values could smuggle in a hash prefix, e.g. 0x01 || left
+		if !isHash(sib) {
+			return false
+		}
+	}
+
+	combine := hashPair
+	if verifierMode(opts) {
+		combine = hashChildren
+	}
 
 	// Recompute root from leaf using siblings, compare to expected root
 	hash := proof.LeafHash
@@ -184,10 +276,10 @@ func VerifyProof(proof *MerkleProof) bool {
 		sibIsRight := proof.PathBits[i]
 		if sibIsRight {
 			// sibling on the right -> parent hash = hash(current || sibling)
-			hash = hashPair(hash, sib)
+			hash = combine(hash, sib)
 		} else {
 			// sibling on left -> parent hash = hash(sibling || current)
-			hash = hashPair(sib, hash)
+			hash = combine(sib, hash)
 		}
 	}
 
@@ -195,6 +287,171 @@ func VerifyProof(proof *MerkleProof) bool {
 	return bytes.Equal(hash, proof.RootHash)
 }
 
+// MerkleMultiProof proves the inclusion of several leaves at once
+// Siblings shared by the leaves' paths, and nodes that can be computed from
+// the proven leaves, are left out, so proving k leaves takes far fewer hashes
+// than k separate MerkleProofs.
+type MerkleMultiProof struct {
+	Indices    []int    // Proven leaf indices, ascending
+	LeafHashes [][]byte // Hashes of the proven leaves, in Indices order
+	// Hashes are the roots of the subtrees holding no proven leaf that
+	// border the proven paths, in left to right order
+	Hashes    [][]byte
+	LeafCount int // Number of leaves in the tree, which fixes its shape
+	RootHash  []byte
+}
+
+// GenerateMultiProof creates one proof for the items at the given indices
+// Duplicate indices are ignored and order does not matter.
+// Time: O(k log n) for k indices
+func (t *MerkleTree) GenerateMultiProof(indices []int) (*MerkleMultiProof, error) {
+	if len(indices) == 0 {
+		return nil, errors.New("No indices to prove")
+	}
+	sorted := append([]int{}, indices...)
+	sort.Ints(sorted)
+	unique := sorted[:1]
+	for _, index := range sorted[1:] {
+		if index != unique[len(unique)-1] {
+			unique = append(unique, index)
+		}
+	}
+	if unique[0] < 0 || len(t.leaves) <= unique[len(unique)-1] {
+		return nil, errors.New("Index out of bounds")
+	}
+
+	proof := &MerkleMultiProof{
+		Indices:    unique,
+		LeafHashes: make([][]byte, len(unique)),
+		Hashes:     [][]byte{},
+		LeafCount:  len(t.leaves),
+		RootHash:   t.root.Hash,
+	}
+	for i, index := range unique {
+		proof.LeafHashes[i] = t.leaves[index].Hash
+	}
+	t.collectMultiProof(proof, t.root, 0, treeSpan(len(t.leaves), t.rfc6962), unique)
+	return proof, nil
+}
+
+// Walk down from n, which covers leaves [start, end), adding the hash of
+// every subtree without a proven leaf where the walk stops
+func (t *MerkleTree) collectMultiProof(proof *MerkleMultiProof, n *MerkleNode, start, end int, indices []int) {
+	if len(indices) == 0 {
+		proof.Hashes = append(proof.Hashes, n.Hash)
+		return
+	}
+	if end-start == 1 {
+		return
+	}
+	mid, duplicate := splitSpan(len(t.leaves), t.rfc6962, start, end)
+	i := sort.SearchInts(indices, mid)
+	t.collectMultiProof(proof, n.Left, start, mid, indices[:i])
+	if !duplicate {
+		t.collectMultiProof(proof, n.Right, mid, end, indices[i:])
+	}
+}
+
+// VerifyMultiProof checks that every leaf in the proof is in the tree with RootHash
+// Pass the options the tree was built with, as for VerifyProof.
+// Time: O(k log n)
+func VerifyMultiProof(proof *MerkleMultiProof, opts ...MerkleOption) bool {
+	if proof == nil || len(proof.Indices) == 0 || len(proof.Indices) != len(proof.LeafHashes) || !isHash(proof.RootHash) {
+		return false
+	}
+	for i, index := range proof.Indices {
+		if index < 0 || proof.LeafCount <= index || (i > 0 && index <= proof.Indices[i-1]) {
+			return false
+		}
+	}
+	for _, hashes := range [][][]byte{proof.LeafHashes, proof.Hashes} {
+		for _, hash := range hashes {
+			if !isHash(hash) {
+				return false
+			}
+		}
+	}
+
+	rfc6962 := verifierMode(opts)
+	combine := hashPair
+	if rfc6962 {
+		combine = hashChildren
+	}
+	leaves, hashes := proof.LeafHashes, proof.Hashes
+
+	// Rebuild the root the way the proof was collected: left to right,
+	// taking a proof hash for every subtree without a proven leaf
+	var rebuild func(start, end int, indices []int) []byte
+	rebuild = func(start, end int, indices []int) []byte {
+		if len(indices) == 0 {
+			if len(hashes) == 0 {
+				return nil
+			}
+			hash := hashes[0]
+			hashes = hashes[1:]
+			return hash
+		}
+		if end-start == 1 {
+			hash := leaves[0]
+			leaves = leaves[1:]
+			return hash
+		}
+		mid, duplicate := splitSpan(proof.LeafCount, rfc6962, start, end)
+		i := sort.SearchInts(indices, mid)
+		left := rebuild(start, mid, indices[:i])
+		right := left
+		if !duplicate {
+			right = rebuild(mid, end, indices[i:])
+		}
+		if left == nil || right == nil {
+			return nil
+		}
+		return combine(left, right)
+	}
+
+	root := rebuild(0, treeSpan(proof.LeafCount, rfc6962), proof.Indices)
+	return root != nil && len(hashes) == 0 && bytes.Equal(root, proof.RootHash)
+}
+
+// Whether a verifier given opts expects an RFC 6962 tree
+func verifierMode(opts []MerkleOption) bool {
+	var t MerkleTree
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t.rfc6962
+}
+
+// Whether b has the length of a SHA-256 hash
+func isHash(b []byte) bool {
+	return len(b) == sha256.Size
+}
+
+// Number of leaf positions the root of a tree with n leaves spans
+// The default tree is a perfect tree whose missing right nodes duplicate
+// their left sibling, so its root spans the next power of two.
+func treeSpan(n int, rfc6962 bool) int {
+	if rfc6962 {
+		return n
+	}
+	span := 1
+	for span < n {
+		span <<= 1
+	}
+	return span
+}
+
+// Where the node over leaf positions [start, end) splits into its children
+// duplicate is set when the right child is a copy of the left because no
+// leaves exist past mid (default tree only).
+func splitSpan(n int, rfc6962 bool, start, end int) (mid int, duplicate bool) {
+	if rfc6962 {
+		return start + splitPoint(end-start), false
+	}
+	mid = start + (end-start)/2
+	return mid, n <= mid
+}
+
 // SparseMerkleTree implements a sparse Merkle tree
 // Useful for key-value stores with a fixed key space (e.g., 256-bit keys)
 // https://medium.com/@kelvinfichter/whats-a-sparse-merkle-tree-acda70aeb837
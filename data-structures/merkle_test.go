@@ -3,6 +3,9 @@ package datastructures
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
 	"testing"
 )
 
@@ -500,3 +503,377 @@ func TestIsRightChild(t *testing.T) {
 		}
 	}
 }
+
+// ========== RFC 6962 Tests ==========
+
+// Test vectors from RFC 6962 reference implementations (Certificate Transparency)
+var rfc6962Leaves = []string{
+	"", "00", "10", "2021", "3031", "40414243",
+	"5051525354555657", "606162636465666768696a6b6c6d6e6f",
+}
+
+// rfc6962Roots[n] is the root of the first n leaves
+var rfc6962Roots = []string{
+	"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func rfc6962Data(t *testing.T, n int) [][]byte {
+	t.Helper()
+	data := make([][]byte, n)
+	for i := range data {
+		b, err := hex.DecodeString(rfc6962Leaves[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[i] = b
+	}
+	return data
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMerkleTree_RFC6962Roots(t *testing.T) {
+	for n, want := range rfc6962Roots {
+		tree := NewMerkleTree(rfc6962Data(t, n), WithRFC6962())
+		if got := hex.EncodeToString(tree.Root()); got != want {
+			t.Errorf("Root of %d leaves = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestMerkleTree_RFC6962AuditPaths(t *testing.T) {
+	tests := []struct {
+		index, size int
+		path        []string
+	}{
+		{0, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{5, 8, []string{
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 3, []string{
+			"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		}},
+		{1, 5, []string{
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+		{0, 1, nil},
+	}
+	for _, tt := range tests {
+		data := rfc6962Data(t, tt.size)
+		tree := NewMerkleTree(data, WithRFC6962())
+		proof, err := tree.GenerateProof(tt.index)
+		if err != nil {
+			t.Fatalf("GenerateProof(%d) of %d: %v", tt.index, tt.size, err)
+		}
+		if len(proof.Siblings) != len(tt.path) {
+			t.Fatalf("Proof of %d in %d has %d siblings, want %d", tt.index, tt.size, len(proof.Siblings), len(tt.path))
+		}
+		for i, want := range tt.path {
+			if got := hex.EncodeToString(proof.Siblings[i]); got != want {
+				t.Errorf("Proof of %d in %d: sibling %d = %s, want %s", tt.index, tt.size, i, got, want)
+			}
+		}
+		if !bytes.Equal(proof.LeafHash, RFC6962LeafHash(data[tt.index])) {
+			t.Errorf("Proof of %d in %d has the wrong leaf hash", tt.index, tt.size)
+		}
+		if !bytes.Equal(proof.RootHash, mustHex(t, rfc6962Roots[tt.size])) || !VerifyProof(proof, WithRFC6962()) {
+			t.Errorf("Proof of %d in %d does not verify against the RFC root", tt.index, tt.size)
+		}
+	}
+}
+
+func TestMerkleTree_ProofsInBothModes(t *testing.T) {
+	for _, rfc := range []bool{false, true} {
+		for n := 1; n <= 20; n++ {
+			data := make([][]byte, n)
+			for i := range data {
+				data[i] = []byte{byte(i)}
+			}
+			opts, otherOpts := modeOptions(rfc)
+			tree := NewMerkleTree(data, opts...)
+			for i := range data {
+				proof, err := tree.GenerateProof(i)
+				if err != nil {
+					t.Fatalf("rfc6962=%v n=%d: GenerateProof(%d): %v", rfc, n, i, err)
+				}
+				if !VerifyProof(proof, opts...) {
+					t.Errorf("rfc6962=%v n=%d: proof for %d does not verify", rfc, n, i)
+				}
+				// Verifying in the other mode must fail for any non-trivial proof
+				if len(proof.Siblings) > 0 && VerifyProof(proof, otherOpts...) {
+					t.Errorf("rfc6962=%v n=%d: proof for %d verifies in the wrong mode", rfc, n, i)
+				}
+			}
+		}
+	}
+}
+
+// Options building a tree in the given mode, and those of the other mode
+func modeOptions(rfc bool) (opts, other []MerkleOption) {
+	if rfc {
+		return []MerkleOption{WithRFC6962()}, nil
+	}
+	return nil, []MerkleOption{WithRFC6962()}
+}
+
+func TestMerkleTree_MalformedHashLengths(t *testing.T) {
+	data := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+	tree := NewMerkleTree(data)
+	proof, _ := tree.GenerateProof(0)
+
+	// In the default mode hashPair(0x01 || left, right) is the RFC 6962
+	// interior node hash, so a 33-byte leaf hash could stand in for a subtree
+	rfcTree := NewMerkleTree(data, WithRFC6962())
+	l := rfcTree.root.Left
+	leaf := append([]byte{0x01}, l.Left.Hash...)
+	if !bytes.Equal(hashPair(leaf, l.Right.Hash), l.Hash) {
+		t.Fatal("Expected 0x01 || left to hash like an RFC 6962 interior node")
+	}
+	forged := &MerkleProof{
+		LeafHash: leaf,
+		Siblings: [][]byte{l.Right.Hash},
+		PathBits: []bool{true},
+		RootHash: l.Hash,
+	}
+	if VerifyProof(forged) {
+		t.Error("Proof with a 33-byte leaf hash verified")
+	}
+
+	tests := map[string]func(p *MerkleProof){
+		"short leaf":    func(p *MerkleProof) { p.LeafHash = p.LeafHash[:31] },
+		"long sibling":  func(p *MerkleProof) { p.Siblings[0] = append([]byte{0x01}, p.Siblings[0]...) },
+		"short root":    func(p *MerkleProof) { p.RootHash = p.RootHash[:16] },
+		"empty sibling": func(p *MerkleProof) { p.Siblings[1] = nil },
+	}
+	for name, tamper := range tests {
+		bad := *proof
+		bad.Siblings = append([][]byte{}, proof.Siblings...)
+		tamper(&bad)
+		if VerifyProof(&bad) {
+			t.Errorf("Proof with %s verified", name)
+		}
+	}
+}
+
+func TestMerkleTree_DuplicateLeafAmbiguity(t *testing.T) {
+	abc := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	abcc := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("c")}
+
+	// Duplicating the last node makes [a b c] and [a b c c] indistinguishable
+	if !bytes.Equal(NewMerkleTree(abc).Root(), NewMerkleTree(abcc).Root()) {
+		t.Error("Expected the default tree to give [a b c] and [a b c c] the same root")
+	}
+	if bytes.Equal(NewMerkleTree(abc, WithRFC6962()).Root(), NewMerkleTree(abcc, WithRFC6962()).Root()) {
+		t.Error("RFC 6962 tree should give [a b c] and [a b c c] different roots")
+	}
+}
+
+func TestMerkleTree_SecondPreimage(t *testing.T) {
+	data := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+
+	// Presenting the two interior nodes' preimages as leaves forges the same root
+	forge := func(tree *MerkleTree) [][]byte {
+		l, r := tree.root.Left, tree.root.Right
+		return [][]byte{
+			append(append([]byte{}, l.Left.Hash...), l.Right.Hash...),
+			append(append([]byte{}, r.Left.Hash...), r.Right.Hash...),
+		}
+	}
+
+	tree := NewMerkleTree(data)
+	if !bytes.Equal(NewMerkleTree(forge(tree)).Root(), tree.Root()) {
+		t.Error("Expected interior nodes to pass as leaves in the default tree")
+	}
+	tree = NewMerkleTree(data, WithRFC6962())
+	if bytes.Equal(NewMerkleTree(forge(tree), WithRFC6962()).Root(), tree.Root()) {
+		t.Error("RFC 6962 tree accepted interior nodes as leaves")
+	}
+}
+
+// ========== Multiproof Tests ==========
+
+func multiProofTree(n int, rfc bool) *MerkleTree {
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = []byte(fmt.Sprintf("leaf %d", i))
+	}
+	if rfc {
+		return NewMerkleTree(data, WithRFC6962())
+	}
+	return NewMerkleTree(data)
+}
+
+func TestMerkleTree_MultiProofAllSubsets(t *testing.T) {
+	for _, rfc := range []bool{false, true} {
+		opts, _ := modeOptions(rfc)
+		for n := 1; n <= 9; n++ {
+			tree := multiProofTree(n, rfc)
+			// Every non-empty subset of leaves
+			for mask := 1; mask < 1<<n; mask++ {
+				var indices []int
+				for i := 0; i < n; i++ {
+					if mask&(1<<i) != 0 {
+						indices = append(indices, i)
+					}
+				}
+				proof, err := tree.GenerateMultiProof(indices)
+				if err != nil {
+					t.Fatalf("rfc6962=%v n=%d %v: %v", rfc, n, indices, err)
+				}
+				if !VerifyMultiProof(proof, opts...) {
+					t.Errorf("rfc6962=%v n=%d %v: proof does not verify", rfc, n, indices)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkleTree_MultiProofLargeTrees(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, rfc := range []bool{false, true} {
+		opts, _ := modeOptions(rfc)
+		for _, n := range []int{33, 100, 1000} {
+			tree := multiProofTree(n, rfc)
+			for _, k := range []int{1, 2, 10, n / 2, n} {
+				proof, err := tree.GenerateMultiProof(rng.Perm(n)[:k])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !VerifyMultiProof(proof, opts...) {
+					t.Errorf("rfc6962=%v n=%d k=%d: proof does not verify", rfc, n, k)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkleTree_MultiProofSize(t *testing.T) {
+	tree := multiProofTree(8, true)
+
+	// Proving every leaf needs no extra hashes
+	proof, _ := tree.GenerateMultiProof([]int{0, 1, 2, 3, 4, 5, 6, 7})
+	if len(proof.Hashes) != 0 {
+		t.Errorf("All leaves: got %d hashes, want 0", len(proof.Hashes))
+	}
+
+	// Siblings 0 and 1 share their path above the first level
+	proof, _ = tree.GenerateMultiProof([]int{1, 0})
+	if len(proof.Hashes) != 2 {
+		t.Errorf("Leaves 0 and 1: got %d hashes, want 2", len(proof.Hashes))
+	}
+	if proof.Indices[0] != 0 || proof.Indices[1] != 1 {
+		t.Errorf("Indices = %v, want sorted [0 1]", proof.Indices)
+	}
+
+	// Leaves 0 and 7 only share the root, whose children are both computed: 2 hashes each
+	proof, _ = tree.GenerateMultiProof([]int{0, 7, 7})
+	if len(proof.Indices) != 2 || len(proof.Hashes) != 4 {
+		t.Errorf("Leaves 0 and 7: got %d indices and %d hashes, want 2 and 4", len(proof.Indices), len(proof.Hashes))
+	}
+
+	// A duplicated node in the default tree is never sent
+	proof, _ = multiProofTree(3, false).GenerateMultiProof([]int{2})
+	if len(proof.Hashes) != 1 || !VerifyMultiProof(proof) {
+		t.Errorf("Leaf 2 of 3: got %d hashes, want 1", len(proof.Hashes))
+	}
+}
+
+func TestMerkleTree_MultiProofTampered(t *testing.T) {
+	for _, rfc := range []bool{false, true} {
+		opts, otherOpts := modeOptions(rfc)
+		tree := multiProofTree(13, rfc)
+		fresh := func() *MerkleMultiProof {
+			proof, _ := tree.GenerateMultiProof([]int{2, 3, 9})
+			return proof
+		}
+
+		tests := map[string]func(p *MerkleMultiProof){
+			"leaf hash":       func(p *MerkleMultiProof) { p.LeafHashes[1] = bytes.Repeat([]byte{0xAA}, 32) },
+			"proof hash":      func(p *MerkleMultiProof) { p.Hashes[0] = bytes.Repeat([]byte{0xAA}, 32) },
+			"long leaf hash":  func(p *MerkleMultiProof) { p.LeafHashes[0] = append([]byte{0x01}, p.LeafHashes[0]...) },
+			"missing hash":    func(p *MerkleMultiProof) { p.Hashes = p.Hashes[1:] },
+			"extra hash":      func(p *MerkleMultiProof) { p.Hashes = append(p.Hashes, p.Hashes[0]) },
+			"other index":     func(p *MerkleMultiProof) { p.Indices[2] = 10 },
+			"unsorted":        func(p *MerkleMultiProof) { p.Indices[0], p.Indices[1] = p.Indices[1], p.Indices[0] },
+			"index too large": func(p *MerkleMultiProof) { p.Indices[2] = 13 },
+			"leaf count":      func(p *MerkleMultiProof) { p.LeafCount = 20 },
+			"missing leaf":    func(p *MerkleMultiProof) { p.LeafHashes = p.LeafHashes[:2] },
+		}
+		for name, tamper := range tests {
+			proof := fresh()
+			tamper(proof)
+			if VerifyMultiProof(proof, opts...) {
+				t.Errorf("rfc6962=%v: proof with tampered %s verified", rfc, name)
+			}
+		}
+		if proof := fresh(); !VerifyMultiProof(proof, opts...) || VerifyMultiProof(proof, otherOpts...) {
+			t.Errorf("rfc6962=%v: proof should only verify in the mode of its tree", rfc)
+		}
+	}
+	if VerifyMultiProof(nil) {
+		t.Error("VerifyMultiProof(nil) should be false")
+	}
+}
+
+func TestMerkleTree_MultiProofErrors(t *testing.T) {
+	tree := multiProofTree(4, false)
+	for _, indices := range [][]int{nil, {-1}, {0, 4}} {
+		if _, err := tree.GenerateMultiProof(indices); err == nil {
+			t.Errorf("GenerateMultiProof(%v) should return error", indices)
+		}
+	}
+	if _, err := NewMerkleTree(nil).GenerateMultiProof([]int{0}); err == nil {
+		t.Error("GenerateMultiProof on an empty tree should return error")
+	}
+}
+
+// Compares the number of hashes sent for k leaves of a 4096 leaf tree:
+// one multiproof vs k single proofs
+func BenchmarkMerkleTree_MultiProofSize(b *testing.B) {
+	const n = 4096
+	tree := multiProofTree(n, true)
+	for _, k := range []int{1, 16, 256, 2048} {
+		indices := rand.New(rand.NewSource(1)).Perm(n)[:k]
+		b.Run(fmt.Sprintf("multi/k=%d", k), func(b *testing.B) {
+			var proof *MerkleMultiProof
+			for i := 0; i < b.N; i++ {
+				proof, _ = tree.GenerateMultiProof(indices)
+			}
+			b.ReportMetric(float64(len(proof.Hashes)), "hashes")
+		})
+		b.Run(fmt.Sprintf("single/k=%d", k), func(b *testing.B) {
+			var hashes int
+			for i := 0; i < b.N; i++ {
+				hashes = 0
+				for _, index := range indices {
+					proof, _ := tree.GenerateProof(index)
+					hashes += len(proof.Siblings)
+				}
+			}
+			b.ReportMetric(float64(hashes), "hashes")
+		})
+	}
+}
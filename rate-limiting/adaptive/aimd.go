@@ -0,0 +1,51 @@
+package adaptive
+
+import "time"
+
+// AIMD is additive-increase/multiplicative-decrease, as in TCP Reno
+// The limit grows by Increase per round trip (a limit's worth of successful
+// samples) while the limiter is in use, and is multiplied by Backoff when a
+// request is dropped or slower than Timeout.
+type AIMD struct {
+	Increase float64       // Added per round trip, default 1
+	Backoff  float64       // Multiplier on drop, default 0.9
+	Timeout  time.Duration // Samples slower than this count as dropped (0 = only explicit drops)
+
+	gate backoffGate
+}
+
+// Update implements Algorithm
+func (a *AIMD) Update(limit float64, s Sample) float64 {
+	if s.Dropped || (a.Timeout > 0 && s.RTT > a.Timeout) {
+		return a.gate.backoff(limit, s, a.Backoff)
+	}
+
+	// Don't grow a limit that isn't being used, or an idle period would
+	// let it drift far above what the downstream can take
+	if float64(s.InFlight)*2 < limit {
+		return limit
+	}
+	increase := a.Increase
+	if increase == 0 {
+		increase = 1
+	}
+	return limit + increase/limit
+}
+
+// Backs off at most once per round trip, like TCP once per window
+// Requests already in flight at the last backoff saw the same congestion,
+// counting their drops too would collapse the limit.
+type backoffGate struct {
+	last time.Time
+}
+
+func (g *backoffGate) backoff(limit float64, s Sample, factor float64) float64 {
+	if s.Start.Before(g.last) {
+		return limit
+	}
+	g.last = s.Start.Add(s.RTT)
+	if factor == 0 {
+		factor = 0.9
+	}
+	return limit * factor
+}
@@ -0,0 +1,60 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+func TestAIMD_ConvergesToCapacity(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	b := backend{capacity: 40, base: 10 * time.Millisecond}
+	l := New(
+		WithAlgorithm(&AIMD{Timeout: 12 * time.Millisecond}),
+		WithInitialLimit(5),
+		WithClock(clock),
+	)
+
+	limits := simulate(l, clock, b, 200, 300)
+	// Latency passes the timeout above 48 in flight
+	for _, limit := range limits[200:] {
+		if limit < 40 || limit > 50 {
+			t.Fatalf("Expected limit to oscillate between 40 and 50, got %d", limit)
+		}
+	}
+
+	// The downstream degrades, the limit follows it down
+	b.capacity = 10
+	limits = simulate(l, clock, b, 200, 100)
+	for _, limit := range limits[50:] {
+		if limit < 10 || limit > 13 {
+			t.Fatalf("Expected limit to follow capacity down to 10-12, got %d", limit)
+		}
+	}
+}
+
+func TestAIMD_BacksOffOnErrors(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	l := New(WithAlgorithm(&AIMD{Backoff: 0.5}), WithInitialLimit(100), WithClock(clock))
+
+	p, _ := l.Acquire()
+	p.Release(Dropped)
+	if got := l.Limit(); got != 50 {
+		t.Errorf("Expected limit halved to 50, got %d", got)
+	}
+	if got := l.Stats().Dropped; got != 1 {
+		t.Errorf("Expected 1 drop counted, got %d", got)
+	}
+}
+
+func TestAIMD_IdleDoesNotGrow(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	l := New(WithInitialLimit(20), WithClock(clock))
+
+	// One request at a time never uses half the limit
+	simulate(l, clock, backend{capacity: 100, base: time.Millisecond}, 1, 1000)
+	if got := l.Limit(); got != 20 {
+		t.Errorf("Expected limit to stay at 20 while underused, got %d", got)
+	}
+}
@@ -0,0 +1,202 @@
+// Package adaptive limits concurrency to a limit learned from the latency
+// and errors of a downstream, instead of a hand-picked rate.
+//
+// Every request holds a Permit while in flight. Releasing it reports the
+// outcome and round trip time to an Algorithm (AIMD or Vegas), which raises
+// the limit while the downstream keeps up and lowers it when latency grows
+// or requests fail.
+package adaptive
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Outcome of a request, reported when its permit is released
+type Outcome int
+
+const (
+	// Success means the downstream handled the request
+	Success Outcome = iota
+
+	// Dropped means the request failed because of load (error, timeout, 503)
+	// and the limit should back off
+	Dropped
+
+	// Ignored means the outcome says nothing about the downstream
+	// (e.g. cancelled by the client), only the in-flight count is updated
+	Ignored
+)
+
+// Sample is what an Algorithm learns from one released permit
+type Sample struct {
+	Start    time.Time     // When the permit was acquired
+	RTT      time.Duration // Time from Acquire to Release
+	InFlight int           // Requests in flight when the permit was acquired, including it
+	Dropped  bool          // Outcome was Dropped
+}
+
+// Algorithm computes a new concurrency limit from a sample
+// Called with the limiter's lock held, so implementations may keep state
+// without their own locking.
+type Algorithm interface {
+	Update(limit float64, s Sample) float64
+}
+
+// Limiter caps the number of requests in flight to an adaptive limit
+type Limiter struct {
+	mu       sync.Mutex
+	algo     Algorithm
+	clock    tokenbucket.Clock
+	limit    float64
+	minLimit int
+	maxLimit int
+	inflight int
+	stats    Stats
+}
+
+// Stats are counters for a Limiter
+type Stats struct {
+	Acquired uint64 // Permits handed out
+	Rejected uint64 // Acquire calls over the limit
+	Dropped  uint64 // Permits released with Dropped
+}
+
+// Option configures a Limiter
+type Option func(*Limiter)
+
+// WithAlgorithm sets how the limit adapts
+// Defaults to &AIMD{}
+func WithAlgorithm(algo Algorithm) Option {
+	return func(l *Limiter) {
+		l.algo = algo
+	}
+}
+
+// WithInitialLimit sets the starting limit
+// Defaults to 20
+func WithInitialLimit(limit int) Option {
+	return func(l *Limiter) {
+		l.limit = float64(limit)
+	}
+}
+
+// WithLimits bounds the limit to [min, max]
+// Defaults to [1, 1000]
+func WithLimits(min, max int) Option {
+	return func(l *Limiter) {
+		l.minLimit = min
+		l.maxLimit = max
+	}
+}
+
+// WithClock sets the clock used to measure round trip times
+func WithClock(clock tokenbucket.Clock) Option {
+	return func(l *Limiter) {
+		l.clock = clock
+	}
+}
+
+// New creates an adaptive concurrency limiter
+func New(opts ...Option) *Limiter {
+	l := &Limiter{
+		algo:     &AIMD{},
+		clock:    tokenbucket.RealClock{},
+		limit:    20,
+		minLimit: 1,
+		maxLimit: 1000,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.limit = l.clamp(l.limit)
+	return l
+}
+
+// Permit is held by a request in flight
+type Permit struct {
+	l        *Limiter
+	start    time.Time
+	inflight int
+	released bool // Guarded by l.mu
+}
+
+// Acquire takes a permit if fewer than Limit() requests are in flight
+// Returns false without blocking otherwise. Every permit must be released.
+func (l *Limiter) Acquire() (*Permit, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= l.currentLimit() {
+		l.stats.Rejected++
+		return nil, false
+	}
+	l.inflight++
+	l.stats.Acquired++
+	return &Permit{
+		l:        l,
+		start:    l.clock.Now(),
+		inflight: l.inflight,
+	}, true
+}
+
+// Release returns the permit and reports the request's outcome
+// Releasing a permit more than once has no effect.
+func (p *Permit) Release(outcome Outcome) {
+	l := p.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if p.released {
+		return
+	}
+	p.released = true
+	l.inflight--
+
+	if outcome == Ignored {
+		return
+	}
+	if outcome == Dropped {
+		l.stats.Dropped++
+	}
+	s := Sample{
+		Start:    p.start,
+		RTT:      l.clock.Now().Sub(p.start),
+		InFlight: p.inflight,
+		Dropped:  outcome == Dropped,
+	}
+	l.limit = l.clamp(l.algo.Update(l.limit, s))
+}
+
+// Limit returns the current concurrency limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.currentLimit()
+}
+
+// InFlight returns the number of permits not yet released
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Stats returns the limiter's counters
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Caller must hold l.mu
+func (l *Limiter) currentLimit() int {
+	return int(l.limit)
+}
+
+func (l *Limiter) clamp(limit float64) float64 {
+	return math.Max(float64(l.minLimit), math.Min(limit, float64(l.maxLimit)))
+}
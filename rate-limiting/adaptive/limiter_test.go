@@ -0,0 +1,141 @@
+package adaptive
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// backend simulates a downstream that serves capacity requests concurrently
+// Above capacity requests queue, so latency grows with load, and above
+// twice the capacity they fail.
+type backend struct {
+	capacity int
+	base     time.Duration
+}
+
+func (b backend) serve(inflight int) (time.Duration, Outcome) {
+	if inflight <= b.capacity {
+		return b.base, Success
+	}
+	latency := b.base * time.Duration(inflight) / time.Duration(b.capacity)
+	if inflight > 2*b.capacity {
+		return latency, Dropped
+	}
+	return latency, Success
+}
+
+// Run rounds of demand concurrent requests against the backend
+// Each round acquires as many permits as the limiter allows, advances the
+// clock by the resulting latency and releases them. Returns the limit after
+// each round.
+func simulate(l *Limiter, clock *tokenbucket.FakeClock, b backend, demand, rounds int) []int {
+	limits := make([]int, 0, rounds)
+	for i := 0; i < rounds; i++ {
+		var permits []*Permit
+		for len(permits) < demand {
+			p, ok := l.Acquire()
+			if !ok {
+				break
+			}
+			permits = append(permits, p)
+		}
+		latency, outcome := b.serve(len(permits))
+		clock.Advance(latency)
+		for _, p := range permits {
+			p.Release(outcome)
+		}
+		limits = append(limits, l.Limit())
+	}
+	return limits
+}
+
+func TestLimiter_AcquireUpToLimit(t *testing.T) {
+	l := New(WithInitialLimit(3), WithClock(tokenbucket.NewFakeClock(epoch)))
+
+	var permits []*Permit
+	for i := 0; i < 3; i++ {
+		p, ok := l.Acquire()
+		if !ok {
+			t.Fatalf("Acquire %d should succeed", i)
+		}
+		permits = append(permits, p)
+	}
+	if _, ok := l.Acquire(); ok {
+		t.Error("Acquire over the limit should fail")
+	}
+	if got := l.InFlight(); got != 3 {
+		t.Errorf("Expected 3 in flight, got %d", got)
+	}
+
+	permits[0].Release(Ignored)
+	permits[0].Release(Ignored) // Double release is a no-op
+	if got := l.InFlight(); got != 2 {
+		t.Errorf("Expected 2 in flight after release, got %d", got)
+	}
+	if _, ok := l.Acquire(); !ok {
+		t.Error("Acquire after release should succeed")
+	}
+
+	stats := l.Stats()
+	if stats.Acquired != 4 || stats.Rejected != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestLimiter_IgnoredDoesNotAdapt(t *testing.T) {
+	l := New(WithInitialLimit(10), WithClock(tokenbucket.NewFakeClock(epoch)))
+	for i := 0; i < 100; i++ {
+		p, _ := l.Acquire()
+		p.Release(Ignored)
+	}
+	p, _ := l.Acquire()
+	p.Release(Dropped)
+	if got := l.Limit(); got != 9 {
+		t.Errorf("Expected only the drop to change the limit to 9, got %d", got)
+	}
+}
+
+func TestLimiter_Bounds(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	l := New(WithInitialLimit(5), WithLimits(4, 8), WithClock(clock))
+
+	for i := 0; i < 50; i++ {
+		p, _ := l.Acquire()
+		p.Release(Dropped)
+	}
+	if got := l.Limit(); got != 4 {
+		t.Errorf("Expected limit clamped to min 4, got %d", got)
+	}
+
+	simulate(l, clock, backend{capacity: 100, base: 10 * time.Millisecond}, 100, 200)
+	if got := l.Limit(); got != 8 {
+		t.Errorf("Expected limit clamped to max 8, got %d", got)
+	}
+}
+
+func TestLimiter_ConcurrentAccess(t *testing.T) {
+	l := New(WithInitialLimit(50))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if p, ok := l.Acquire(); ok {
+					p.Release(Outcome((i + j) % 3))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := l.InFlight(); got != 0 {
+		t.Errorf("Expected nothing in flight, got %d", got)
+	}
+}
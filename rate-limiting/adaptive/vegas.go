@@ -0,0 +1,83 @@
+package adaptive
+
+import "time"
+
+// Vegas adapts the limit to the queueing delay, as in TCP Vegas
+// The lowest RTT seen is taken as the no-load latency. A sample's RTT above
+// it means requests are queueing downstream, estimated as
+//
+//	queue = limit * (1 - minRTT/RTT)
+//
+// The limit grows while queue < Alpha and shrinks while queue > Beta, by one
+// per round trip, so it settles just above the downstream's capacity
+// before errors start. Drops back off multiplicatively like AIMD.
+type Vegas struct {
+	Alpha   float64 // Grow below this many queued requests, default 3
+	Beta    float64 // Shrink above this many queued requests, default 6
+	Backoff float64 // Multiplier on drop, default 0.9
+
+	// Re-measure minRTT every ProbeInterval samples so a lasting change in
+	// the downstream's base latency is learned (0 = never). Like BBR's
+	// ProbeRTT, the limit is halved for one round trip to drain the queue,
+	// then restored.
+	ProbeInterval int
+
+	minRTT     time.Duration
+	samples    int
+	gate       backoffGate
+	probeStart time.Time // Non-zero while probing
+	probeLimit float64   // Limit to restore after probing
+}
+
+// Update implements Algorithm
+func (v *Vegas) Update(limit float64, s Sample) float64 {
+	probing := !v.probeStart.IsZero()
+	if s.Dropped {
+		if probing {
+			v.probeLimit = v.gate.backoff(v.probeLimit, s, v.Backoff)
+			return limit
+		}
+		return v.gate.backoff(limit, s, v.Backoff)
+	}
+
+	if probing {
+		// Requests from before the probe may still have been queued
+		if s.Start.Before(v.probeStart) {
+			return limit
+		}
+		v.minRTT = s.RTT
+		v.probeStart = time.Time{}
+		return v.probeLimit
+	}
+
+	v.samples++
+	if v.ProbeInterval > 0 && v.samples%v.ProbeInterval == 0 {
+		v.probeStart = s.Start.Add(s.RTT)
+		v.probeLimit = limit
+		return limit / 2
+	}
+	if v.minRTT == 0 || s.RTT < v.minRTT {
+		v.minRTT = s.RTT
+	}
+	if s.RTT <= 0 {
+		return limit
+	}
+
+	alpha, beta := v.Alpha, v.Beta
+	if alpha == 0 {
+		alpha = 3
+	}
+	if beta == 0 {
+		beta = 6
+	}
+
+	queue := limit * (1 - float64(v.minRTT)/float64(s.RTT))
+	switch {
+	case queue > beta:
+		return limit - 1/limit
+	case queue < alpha && float64(s.InFlight)*2 >= limit:
+		return limit + 1/limit
+	default:
+		return limit
+	}
+}
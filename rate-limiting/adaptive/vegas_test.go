@@ -0,0 +1,58 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+func TestVegas_SettlesAboveCapacity(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	b := backend{capacity: 40, base: 10 * time.Millisecond}
+	l := New(WithAlgorithm(&Vegas{}), WithInitialLimit(5), WithClock(clock))
+
+	limits := simulate(l, clock, b, 200, 300)
+	// Queue of Alpha..Beta requests above capacity, no drops
+	for _, limit := range limits[200:] {
+		if limit < 42 || limit > 47 {
+			t.Fatalf("Expected limit between 42 and 47, got %d", limit)
+		}
+	}
+	if got := l.Stats().Dropped; got != 0 {
+		t.Errorf("Vegas should avoid drops, got %d", got)
+	}
+
+	b.capacity = 20
+	limits = simulate(l, clock, b, 200, 200)
+	if got := limits[len(limits)-1]; got < 21 || got > 27 {
+		t.Errorf("Expected limit to follow capacity down to ~20, got %d", got)
+	}
+}
+
+func TestVegas_ProbeRelearnsBaseLatency(t *testing.T) {
+	for _, tt := range []struct {
+		probe    int
+		min, max int
+	}{
+		{0, 1, 9},     // Every sample looks queued, stuck below capacity
+		{500, 11, 16}, // Re-measured, back to just above capacity
+	} {
+		clock := tokenbucket.NewFakeClock(epoch)
+		l := New(WithAlgorithm(&Vegas{ProbeInterval: tt.probe}), WithInitialLimit(10), WithClock(clock))
+		simulate(l, clock, backend{capacity: 10, base: 5 * time.Millisecond}, 200, 100)
+
+		// Base latency quadruples for good (e.g. the downstream moved region)
+		limits := simulate(l, clock, backend{capacity: 10, base: 20 * time.Millisecond}, 200, 600)
+		highest := 0
+		for _, limit := range limits[500:] {
+			highest = max(highest, limit)
+		}
+		if highest < tt.min || highest > tt.max {
+			t.Errorf("ProbeInterval %d: expected limit between %d and %d, got %d", tt.probe, tt.min, tt.max, highest)
+		}
+		if got := l.Stats().Dropped; got != 0 {
+			t.Errorf("ProbeInterval %d: expected no drops, got %d", tt.probe, got)
+		}
+	}
+}
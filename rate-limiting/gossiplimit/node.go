@@ -0,0 +1,275 @@
+// Package gossiplimit enforces an approximate cluster-wide rate limit
+// without a central store. Every node keeps a local TokenBucket that models
+// the global bucket and gossips its per-key consumption to its peers, which
+// subtract it from their own view. Admitted traffic converges on the global
+// rate; the overshoot is bounded by what nodes admit before they hear about
+// each other, roughly (nodes-1) × (burst + rate × sync interval).
+package gossiplimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kaldun-tech/go-algorithm-practice/algorithms"
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Transport delivers gossip messages to peers
+// Delivery may be asynchronous and lossy; lost deltas only increase overshoot.
+type Transport interface {
+	Send(peer *algorithms.Peer, msg *algorithms.Message)
+}
+
+// Payload of a delta message
+type deltas struct {
+	Origin string         `json:"origin"`
+	Keys   map[string]int `json:"keys"` // Tokens consumed per key since the origin's last sync
+}
+
+// Node is one member of a gossip-synchronized limiter
+// It implements tokenbucket.Limiter against its view of the global bucket.
+type Node struct {
+	ID string
+
+	limiter   *tokenbucket.TokenBucket
+	burst     int
+	transport Transport
+	clock     tokenbucket.Clock
+	fanout    int           // Peers per message (0 = all)
+	ttl       int           // Hops a delta travels
+	seenTTL   time.Duration // How long message IDs are remembered
+
+	mu      sync.Mutex
+	peers   map[string]*algorithms.Peer
+	seen    map[string]time.Time // Message ID -> when first seen
+	pending map[string]int       // Local consumption not gossiped yet
+	seq     uint64
+	rng     *rand.Rand
+}
+
+// Option configures a Node
+type Option func(*Node)
+
+// WithFanout sends each message to n random peers instead of all of them
+// Use with WithTTL so deltas still reach every node by forwarding.
+func WithFanout(n int) Option {
+	return func(node *Node) {
+		node.fanout = n
+	}
+}
+
+// WithTTL sets how many hops a delta travels, default 3
+func WithTTL(hops int) Option {
+	return func(node *Node) {
+		node.ttl = hops
+	}
+}
+
+// WithClock sets the clock for the node's bucket and periodic sync
+func WithClock(clock tokenbucket.Clock) Option {
+	return func(node *Node) {
+		node.clock = clock
+	}
+}
+
+// WithSeed seeds peer selection, for reproducible simulations
+func WithSeed(seed int64) Option {
+	return func(node *Node) {
+		node.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// NewNode creates a node enforcing a share of the global limit of rate per
+// window with the given burst, exchanging deltas over transport
+func NewNode(id string, rate int, window time.Duration, burst int, transport Transport, opts ...Option) *Node {
+	if burst == 0 {
+		burst = rate
+	}
+	n := &Node{
+		ID:        id,
+		burst:     burst,
+		transport: transport,
+		clock:     tokenbucket.RealClock{},
+		ttl:       3,
+		seenTTL:   time.Minute,
+		peers:     make(map[string]*algorithms.Peer),
+		seen:      make(map[string]time.Time),
+		pending:   make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	if n.rng == nil {
+		n.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	n.limiter = tokenbucket.NewTokenBucket(rate, window, burst, tokenbucket.WithClock(n.clock))
+	return n
+}
+
+// AddPeer adds a peer to gossip with
+func (n *Node) AddPeer(peer *algorithms.Peer) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.peers[peer.ID] = peer
+}
+
+// RemovePeer stops gossiping with a peer
+func (n *Node) RemovePeer(peerID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.peers, peerID)
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (n *Node) Allow(key string) bool {
+	return n.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (n *Node) AllowN(key string, count int) bool {
+	return n.AllowWithInfo(key, count).Allowed
+}
+
+// AllowWithInfo checks the node's view of the global bucket and records
+// admitted tokens for the next sync
+func (n *Node) AllowWithInfo(key string, count int) *tokenbucket.Result {
+	result := n.limiter.AllowWithInfo(key, count)
+	if result.Allowed && count > 0 {
+		n.mu.Lock()
+		n.pending[key] += count
+		n.mu.Unlock()
+	}
+	return result
+}
+
+// Reset clears this node's view of key
+// Other nodes keep theirs, so this only helps if done everywhere.
+func (n *Node) Reset(key string) {
+	n.limiter.Reset(key)
+}
+
+// Sync gossips the consumption admitted since the last sync
+func (n *Node) Sync() {
+	n.mu.Lock()
+	n.forgetSeen()
+	if len(n.pending) == 0 {
+		n.mu.Unlock()
+		return
+	}
+	payload, err := json.Marshal(deltas{Origin: n.ID, Keys: n.pending})
+	if err != nil {
+		n.mu.Unlock()
+		return
+	}
+	n.pending = make(map[string]int)
+	n.seq++
+	msg := &algorithms.Message{
+		ID:        fmt.Sprintf("%s/%d", n.ID, n.seq),
+		Payload:   payload,
+		Timestamp: n.clock.Now(),
+		TTL:       n.ttl,
+	}
+	n.seen[msg.ID] = msg.Timestamp
+	peers := n.targets()
+	n.mu.Unlock()
+
+	n.send(peers, msg)
+}
+
+// Receive handles a message from a peer: applies its deltas once and
+// forwards it while its TTL lasts. Returns false for duplicates.
+func (n *Node) Receive(msg *algorithms.Message) bool {
+	var d deltas
+	if err := json.Unmarshal(msg.Payload, &d); err != nil || d.Origin == n.ID {
+		return false
+	}
+
+	n.mu.Lock()
+	if _, ok := n.seen[msg.ID]; ok {
+		n.mu.Unlock()
+		return false
+	}
+	n.seen[msg.ID] = n.clock.Now()
+	var peers []*algorithms.Peer
+	if msg.TTL > 1 {
+		peers = n.targets()
+	}
+	n.mu.Unlock()
+
+	for key, consumed := range d.Keys {
+		n.consume(key, consumed)
+	}
+	if len(peers) > 0 {
+		forward := *msg
+		forward.TTL--
+		n.send(peers, &forward)
+	}
+	return true
+}
+
+// Run calls Sync every interval until ctx is done
+func (n *Node) Run(ctx context.Context, interval time.Duration) {
+	for {
+		timer := n.clock.NewTimer(interval)
+		select {
+		case <-timer.C():
+			n.Sync()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Take tokens other nodes admitted out of the local view, even into debt
+// Reserve never takes more than the burst at once, so large deltas are split.
+func (n *Node) consume(key string, tokens int) {
+	for tokens > 0 {
+		chunk := min(tokens, n.burst)
+		n.limiter.Reserve(key, chunk)
+		tokens -= chunk
+	}
+}
+
+// Pick fanout random peers (or all) to send a message to
+// Caller must hold n.mu
+func (n *Node) targets() []*algorithms.Peer {
+	peers := make([]*algorithms.Peer, 0, len(n.peers))
+	for _, peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	// Sort first so a seeded rng picks the same peers every run
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ID < peers[j].ID
+	})
+	if n.fanout > 0 && n.fanout < len(peers) {
+		n.rng.Shuffle(len(peers), func(i, j int) {
+			peers[i], peers[j] = peers[j], peers[i]
+		})
+		peers = peers[:n.fanout]
+	}
+	return peers
+}
+
+// Send outside n.mu so an in-process transport may deliver synchronously
+func (n *Node) send(peers []*algorithms.Peer, msg *algorithms.Message) {
+	for _, peer := range peers {
+		n.transport.Send(peer, msg)
+	}
+}
+
+// Drop remembered message IDs older than seenTTL
+// Caller must hold n.mu
+func (n *Node) forgetSeen() {
+	now := n.clock.Now()
+	for id, at := range n.seen {
+		if now.Sub(at) > n.seenTTL {
+			delete(n.seen, id)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package gossiplimit
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/kaldun-tech/go-algorithm-practice/algorithms"
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// In-process transport, messages are queued and delivered by deliver
+type network struct {
+	nodes map[string]*Node
+	queue []delivery
+	loss  float64
+	rng   *rand.Rand
+}
+
+type delivery struct {
+	to  string
+	msg *algorithms.Message
+}
+
+func (nw *network) Send(peer *algorithms.Peer, msg *algorithms.Message) {
+	if nw.loss > 0 && nw.rng.Float64() < nw.loss {
+		return
+	}
+	nw.queue = append(nw.queue, delivery{peer.ID, msg})
+}
+
+func (nw *network) deliver() {
+	for len(nw.queue) > 0 {
+		d := nw.queue[0]
+		nw.queue = nw.queue[1:]
+		nw.nodes[d.to].Receive(d.msg)
+	}
+}
+
+type simulation struct {
+	nodes    int
+	rate     int // Global requests per second
+	burst    int
+	duration time.Duration
+	sync     time.Duration // Gossip interval
+	fanout   int
+	ttl      int
+	loss     float64
+	isolated bool // Don't connect the nodes
+}
+
+// Run every node at 1000 requests/s against one key, far above the global
+// rate, and return how many requests the cluster admitted
+func (s simulation) run() int {
+	clock := tokenbucket.NewFakeClock(epoch)
+	nw := &network{nodes: make(map[string]*Node), loss: s.loss, rng: rand.New(rand.NewSource(1))}
+	var nodes []*Node
+	for i := 0; i < s.nodes; i++ {
+		id := fmt.Sprintf("node-%d", i)
+		node := NewNode(id, s.rate, time.Second, s.burst, nw,
+			WithClock(clock), WithFanout(s.fanout), WithTTL(s.ttl), WithSeed(int64(i)))
+		nw.nodes[id] = node
+		nodes = append(nodes, node)
+	}
+	if !s.isolated {
+		for _, a := range nodes {
+			for _, b := range nodes {
+				if a != b {
+					a.AddPeer(&algorithms.Peer{ID: b.ID})
+				}
+			}
+		}
+	}
+
+	admitted := 0
+	for elapsed := time.Duration(0); elapsed < s.duration; elapsed += time.Millisecond {
+		for _, node := range nodes {
+			if node.Allow("topic:blocks") {
+				admitted++
+			}
+		}
+		clock.Advance(time.Millisecond)
+		if (elapsed+time.Millisecond)%s.sync == 0 {
+			for _, node := range nodes {
+				node.Sync()
+			}
+			nw.deliver()
+		}
+	}
+	return admitted
+}
+
+func (s simulation) expected() int {
+	return s.rate*int(s.duration/time.Second) + s.burst
+}
+
+func TestGossip_ConvergesOnGlobalRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		sim       simulation
+		tolerance float64 // Allowed relative error of admitted traffic
+	}{
+		{
+			name:      "full mesh",
+			sim:       simulation{nodes: 5, rate: 100, burst: 10, duration: 10 * time.Second, sync: 50 * time.Millisecond, ttl: 1},
+			tolerance: 0.05,
+		},
+		{
+			name:      "partial fanout with forwarding",
+			sim:       simulation{nodes: 10, rate: 200, burst: 20, duration: 10 * time.Second, sync: 50 * time.Millisecond, fanout: 3, ttl: 4},
+			tolerance: 0.10,
+		},
+		{
+			name:      "lossy network",
+			sim:       simulation{nodes: 5, rate: 100, burst: 10, duration: 10 * time.Second, sync: 50 * time.Millisecond, ttl: 2, loss: 0.1},
+			tolerance: 0.10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admitted, expected := tt.sim.run(), tt.sim.expected()
+			errRate := math.Abs(float64(admitted-expected)) / float64(expected)
+			t.Logf("admitted %d, global limit %d, error %.1f%%", admitted, expected, errRate*100)
+			if errRate > tt.tolerance {
+				t.Errorf("Admitted %d, expected %d ± %.0f%%", admitted, expected, tt.tolerance*100)
+			}
+		})
+	}
+}
+
+func TestGossip_IsolatedNodesOvershoot(t *testing.T) {
+	// Without gossip each node enforces the full global limit on its own
+	sim := simulation{nodes: 5, rate: 100, burst: 10, duration: 10 * time.Second, sync: 50 * time.Millisecond, isolated: true}
+	if admitted := sim.run(); admitted < 4*sim.expected() {
+		t.Errorf("Expected isolated nodes to admit about 5x the limit, got %d", admitted)
+	}
+}
+
+func TestNode_DeduplicatesAndForwards(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	nw := &network{nodes: make(map[string]*Node)}
+	a := NewNode("a", 10, time.Second, 10, nw, WithClock(clock))
+	b := NewNode("b", 10, time.Second, 10, nw, WithClock(clock))
+	c := NewNode("c", 10, time.Second, 10, nw, WithClock(clock))
+	for _, n := range []*Node{a, b, c} {
+		nw.nodes[n.ID] = n
+	}
+	// Line topology a - b - c: c only hears about a through b
+	a.AddPeer(&algorithms.Peer{ID: "b"})
+	b.AddPeer(&algorithms.Peer{ID: "a"})
+	b.AddPeer(&algorithms.Peer{ID: "c"})
+	c.AddPeer(&algorithms.Peer{ID: "b"})
+
+	a.AllowN("k", 4)
+	a.Sync()
+	msg := nw.queue[0].msg
+	nw.deliver()
+
+	if b.Receive(msg) {
+		t.Error("Duplicate message should be ignored")
+	}
+	for _, n := range []*Node{b, c} {
+		if result := n.AllowWithInfo("k", 0); result.Remaining != 6 {
+			t.Errorf("Node %s: expected a's 4 tokens applied once, got %d remaining", n.ID, result.Remaining)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package httplimit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// KeyFunc extracts the rate limit key from a request
+// Returning an error rejects the request with 400 Bad Request.
+type KeyFunc func(r *http.Request) (string, error)
+
+// ErrNoKey is returned by key extractors when the request carries no usable key
+var ErrNoKey = errors.New("httplimit: request has no rate limit key")
+
+// RemoteIP keys requests by client IP address
+// The peer address (r.RemoteAddr) is used unless it belongs to one of the
+// trusted proxies, in which case X-Forwarded-For is walked from right to left
+// and the first address that is not a trusted proxy is the client. Entries
+// left of that are client supplied and cannot be trusted.
+//
+// With no trusted proxies X-Forwarded-For is ignored entirely, otherwise any
+// client could pick its own key by sending the header.
+func RemoteIP(trustedProxies ...netip.Prefix) KeyFunc {
+	trusted := func(addr netip.Addr) bool {
+		for _, p := range trustedProxies {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) (string, error) {
+		peer, err := parseIP(r.RemoteAddr)
+		if err != nil {
+			return "", ErrNoKey
+		}
+		if !trusted(peer) {
+			return "ip:" + peer.String(), nil
+		}
+
+		// Peer is a trusted proxy: find the last untrusted hop it forwarded for
+		client := peer
+		hops := forwardedFor(r)
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := parseIP(hops[i])
+			if err != nil {
+				// Garbage in the header: stop at the last hop we could trust
+				break
+			}
+			client = addr
+			if !trusted(addr) {
+				break
+			}
+		}
+		return "ip:" + client.String(), nil
+	}
+}
+
+// Header keys requests by the value of a request header
+func Header(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		v := r.Header.Get(name)
+		if v == "" {
+			return "", ErrNoKey
+		}
+		return "header:" + v, nil
+	}
+}
+
+// APIKey keys requests by API key, read from the X-API-Key header
+// or an "Authorization: Bearer <key>" header
+func APIKey() KeyFunc {
+	return func(r *http.Request) (string, error) {
+		if v := r.Header.Get("X-API-Key"); v != "" {
+			return "apikey:" + v, nil
+		}
+		if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && v != "" {
+			return "apikey:" + v, nil
+		}
+		return "", ErrNoKey
+	}
+}
+
+// Path keys requests by URL path, i.e. one shared limit per endpoint
+func Path() KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return "path:" + r.URL.Path, nil
+	}
+}
+
+// Collect all X-Forwarded-For entries in order, across repeated headers
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// Parse an IP with or without a port, normalizing IPv4-mapped IPv6
+func parseIP(s string) (netip.Addr, error) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,88 @@
+package httplimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRemoteIP(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		trusted    []netip.Prefix
+		want       string
+	}{
+		{"direct client", "203.0.113.7:1234", nil, proxies, "ip:203.0.113.7"},
+		{"untrusted peer spoofing XFF", "203.0.113.7:1234", []string{"1.2.3.4"}, proxies, "ip:203.0.113.7"},
+		{"XFF ignored without trusted proxies", "10.0.0.1:80", []string{"1.2.3.4"}, nil, "ip:10.0.0.1"},
+		{"one trusted proxy", "10.0.0.1:80", []string{"198.51.100.2"}, proxies, "ip:198.51.100.2"},
+		{"client spoofs leftmost hop", "10.0.0.1:80", []string{"6.6.6.6, 198.51.100.2, 10.0.0.9"}, proxies, "ip:198.51.100.2"},
+		{"repeated headers", "10.0.0.1:80", []string{"6.6.6.6", "198.51.100.2"}, proxies, "ip:198.51.100.2"},
+		{"all hops trusted", "10.0.0.1:80", []string{"10.0.0.2"}, proxies, "ip:10.0.0.2"},
+		{"garbage hop", "10.0.0.1:80", []string{"198.51.100.2, not-an-ip"}, proxies, "ip:10.0.0.1"},
+		{"ipv6 proxy", "[2001:db8::1]:443", []string{"2001:db9::5"}, proxies, "ip:2001:db9::5"},
+		{"ipv4 mapped", "[::ffff:203.0.113.7]:1234", nil, proxies, "ip:203.0.113.7"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, v := range tc.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			got, err := RemoteIP(tc.trusted...)(req)
+			if err != nil {
+				t.Fatalf("RemoteIP returned error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("RemoteIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRemoteIP_BadRemoteAddr(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "nonsense"
+	if _, err := RemoteIP()(req); err != ErrNoKey {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := APIKey()(req); err != ErrNoKey {
+		t.Errorf("Expected ErrNoKey without a key, got %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	if got, _ := APIKey()(req); got != "apikey:secret" {
+		t.Errorf("Bearer token: got %q", got)
+	}
+
+	req.Header.Set("X-API-Key", "abc")
+	if got, _ := APIKey()(req); got != "apikey:abc" {
+		t.Errorf("X-API-Key should take precedence, got %q", got)
+	}
+}
+
+func TestHeaderAndPath(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/blocks?n=1", nil)
+	req.Header.Set("X-Tenant", "acme")
+
+	if got, _ := Header("X-Tenant")(req); got != "header:acme" {
+		t.Errorf("Header: got %q", got)
+	}
+	if got, _ := Path()(req); got != "path:/v1/blocks" {
+		t.Errorf("Path: got %q", got)
+	}
+}
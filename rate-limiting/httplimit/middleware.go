@@ -0,0 +1,118 @@
+package httplimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Middleware rate limits HTTP requests with a tokenbucket.Limiter
+// Every response carries the IETF RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers computed from the limiter's Result. Denied requests
+// get 429 Too Many Requests with a Retry-After header.
+// https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+type Middleware struct {
+	limiter tokenbucket.Limiter
+	key     KeyFunc
+	cost    CostFunc
+	clock   tokenbucket.Clock
+}
+
+// CostFunc returns how many tokens a request consumes (passed to AllowWithInfo)
+type CostFunc func(r *http.Request) int
+
+// Option configures a Middleware
+type Option func(*Middleware)
+
+// WithKeyFunc sets how requests are mapped to rate limit keys
+// Defaults to RemoteIP() with no trusted proxies
+func WithKeyFunc(key KeyFunc) Option {
+	return func(m *Middleware) {
+		m.key = key
+	}
+}
+
+// WithCost sets the per-request cost function
+// Defaults to 1 token per request
+func WithCost(cost CostFunc) Option {
+	return func(m *Middleware) {
+		m.cost = cost
+	}
+}
+
+// WithClock sets the clock used to turn Result.ResetAt into seconds
+// Must match the limiter's clock when it uses a fake one
+func WithClock(clock tokenbucket.Clock) Option {
+	return func(m *Middleware) {
+		m.clock = clock
+	}
+}
+
+// New creates rate limiting middleware backed by limiter
+func New(limiter tokenbucket.Limiter, opts ...Option) *Middleware {
+	m := &Middleware{
+		limiter: limiter,
+		key:     RemoteIP(),
+		cost:    func(*http.Request) int { return 1 },
+		clock:   tokenbucket.RealClock{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Handler wraps next so it is only called for requests within the limit
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := m.key(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := m.limiter.AllowWithInfo(key, m.cost(r))
+		m.setHeaders(w.Header(), result)
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Write the RateLimit-* headers for a result
+func (m *Middleware) setHeaders(h http.Header, result *tokenbucket.Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAt.Sub(m.clock.Now()))))
+}
+
+// Header values are delta-seconds, rounded up so clients never retry too early
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// PathCost returns a CostFunc charging per route
+// The longest path prefix in costs wins; unmatched paths cost defaultCost.
+//
+//	PathCost(map[string]int{"/search": 5, "/upload": 20}, 1)
+func PathCost(costs map[string]int, defaultCost int) CostFunc {
+	return func(r *http.Request) int {
+		cost, longest := defaultCost, -1
+		for prefix, c := range costs {
+			if len(prefix) > longest && strings.HasPrefix(r.URL.Path, prefix) {
+				cost, longest = c, len(prefix)
+			}
+		}
+		return cost
+	}
+}
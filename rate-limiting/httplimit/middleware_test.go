@@ -0,0 +1,132 @@
+package httplimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestMiddleware_AllowsThenDenies(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(2, time.Second, 2, tokenbucket.WithClock(clock))
+	h := New(limiter, WithClock(clock)).Handler(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+
+	rec := serve(h, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("First request: got status %d", rec.Code)
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("RateLimit-Limit = %q, want 2", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Errorf("RateLimit-Remaining = %q, want 1", got)
+	}
+	// One token refills in 500ms, rounded up to whole seconds
+	if got := rec.Header().Get("RateLimit-Reset"); got != "1" {
+		t.Errorf("RateLimit-Reset = %q, want 1", got)
+	}
+
+	serve(h, req)
+	rec = serve(h, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Third request: got status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+
+	// Other clients are unaffected
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.RemoteAddr = "203.0.113.8:4321"
+	if rec := serve(h, other); rec.Code != http.StatusOK {
+		t.Errorf("Other client: got status %d", rec.Code)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if rec := serve(h, req); rec.Code != http.StatusOK {
+		t.Errorf("After refill: got status %d", rec.Code)
+	}
+}
+
+func TestMiddleware_PathCost(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	cost := PathCost(map[string]int{"/search": 5, "/search/deep": 8}, 1)
+	h := New(limiter, WithClock(clock), WithKeyFunc(APIKey()), WithCost(cost)).Handler(okHandler)
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", "k1")
+		return serve(h, req)
+	}
+
+	if rec := request("/search?q=x"); rec.Header().Get("RateLimit-Remaining") != "5" {
+		t.Errorf("/search should cost 5, remaining %s", rec.Header().Get("RateLimit-Remaining"))
+	}
+	if rec := request("/users"); rec.Header().Get("RateLimit-Remaining") != "4" {
+		t.Errorf("/users should cost 1, remaining %s", rec.Header().Get("RateLimit-Remaining"))
+	}
+	// Longest prefix wins: 8 > 4 remaining
+	if rec := request("/search/deep"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("/search/deep should cost 8 and be denied, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_MissingKey(t *testing.T) {
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10)
+	called := false
+	h := New(limiter, WithKeyFunc(Header("X-Tenant"))).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	rec := serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Missing key: got status %d, want 400", rec.Code)
+	}
+	if called {
+		t.Error("Next handler should not run without a key")
+	}
+}
+
+func TestMiddleware_AnyLimiter(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewFixedWindow(1, time.Minute, tokenbucket.WithClock(clock))
+	h := New(limiter, WithClock(clock), WithKeyFunc(Path())).Handler(okHandler)
+
+	serve(h, httptest.NewRequest(http.MethodGet, "/a", nil))
+	rec := serve(h, httptest.NewRequest(http.MethodGet, "/a", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Second request in window: got status %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+}
+
+func TestPathCost_Default(t *testing.T) {
+	cost := PathCost(nil, 3)
+	if got := cost(httptest.NewRequest(http.MethodGet, "/anything", nil)); got != 3 {
+		t.Errorf("Expected default cost 3, got %d", got)
+	}
+}
@@ -0,0 +1,347 @@
+package httplimit
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Transport is an http.RoundTripper that rate limits outgoing requests
+// Requests are paced through a TokenBucket keyed by host. Servers that
+// publish their own limits are listened to: RateLimit-Remaining and
+// RateLimit-Reset temporarily lower the local rate for that key, and
+// Retry-After (or RateLimit-Remaining: 0) holds all requests for the key
+// until the server is ready again. 429 and 503 responses are retried with
+// jittered exponential backoff while the retry budget lasts.
+type Transport struct {
+	base    http.RoundTripper
+	limiter *tokenbucket.TokenBucket
+	key     func(r *http.Request) string
+	clock   tokenbucket.Clock
+
+	maxRetries int
+	budget     time.Duration // Total time one request may spend waiting to retry
+	backoff    time.Duration // First backoff, doubled on every retry
+	maxBackoff time.Duration
+	randMu     sync.Mutex
+	rand       *rand.Rand
+
+	mu      sync.Mutex
+	holds   map[string]time.Time // Key -> time the server said to come back
+	lowered map[string]lowered   // Keys whose policy was lowered from server headers
+}
+
+// The policy a key had before it was lowered, restored once the server's window resets
+type lowered struct {
+	until   time.Time
+	prev    tokenbucket.Policy
+	hadPrev bool // Whether prev was an override rather than the default policy
+}
+
+// TransportOption configures a Transport
+type TransportOption func(*Transport)
+
+// WithBase sets the RoundTripper that sends requests
+// Defaults to http.DefaultTransport
+func WithBase(base http.RoundTripper) TransportOption {
+	return func(t *Transport) {
+		t.base = base
+	}
+}
+
+// WithRequestKey sets how outgoing requests are mapped to rate limit keys
+// Defaults to the request's host (including any port)
+func WithRequestKey(key func(r *http.Request) string) TransportOption {
+	return func(t *Transport) {
+		t.key = key
+	}
+}
+
+// WithRetries sets how often a 429 or 503 response is retried and the total
+// time one request may spend waiting between attempts
+// Defaults to 3 retries within 30 seconds; 0 retries disables retrying.
+func WithRetries(maxRetries int, budget time.Duration) TransportOption {
+	return func(t *Transport) {
+		t.maxRetries = maxRetries
+		t.budget = budget
+	}
+}
+
+// WithBackoff sets the backoff before the first retry and its cap
+// Each retry doubles the backoff and waits a random time up to it (full jitter).
+// Defaults to 100ms capped at 10s. Retry-After or RateLimit-Reset take precedence.
+func WithBackoff(initial, maxBackoff time.Duration) TransportOption {
+	return func(t *Transport) {
+		t.backoff = initial
+		t.maxBackoff = maxBackoff
+	}
+}
+
+// WithTransportClock sets the clock used for holds and backoff
+// Must match the limiter's clock when it uses a fake one
+func WithTransportClock(clock tokenbucket.Clock) TransportOption {
+	return func(t *Transport) {
+		t.clock = clock
+	}
+}
+
+// WithJitterSeed makes backoff jitter deterministic
+func WithJitterSeed(seed int64) TransportOption {
+	return func(t *Transport) {
+		t.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// NewTransport creates a client side rate limiting RoundTripper
+// limiter's policies set the local rate per key; the transport adds and
+// removes exact-key overrides on it as servers report their limits.
+func NewTransport(limiter *tokenbucket.TokenBucket, opts ...TransportOption) *Transport {
+	t := &Transport{
+		base:       http.DefaultTransport,
+		limiter:    limiter,
+		key:        func(r *http.Request) string { return r.URL.Host },
+		clock:      tokenbucket.RealClock{},
+		maxRetries: 3,
+		budget:     30 * time.Second,
+		backoff:    100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		holds:      make(map[string]time.Time),
+		lowered:    make(map[string]lowered),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RoundTrip waits for the request's key to be within its limit and sends it
+// retrying 429 and 503 responses. The request body can only be resent when
+// req.GetBody is set, as it is for requests built by http.NewRequest from
+// an in-memory body; otherwise the first response is returned as is.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	key := t.key(req)
+	var waited time.Duration
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(ctx, key); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+
+		send := req
+		if attempt > 0 {
+			send = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					closeBody(req)
+					return nil, err
+				}
+				send.Body = body
+			}
+		}
+		resp, err := t.base.RoundTrip(send)
+		if err != nil {
+			return nil, err
+		}
+
+		held, isHeld := t.observe(key, resp)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+		if attempt >= t.maxRetries || !replayable(req) {
+			return resp, nil
+		}
+
+		// The server's own estimate beats guessing
+		delay := held
+		if !isHeld {
+			delay = t.jitter(attempt)
+		}
+		if waited+delay > t.budget {
+			return resp, nil
+		}
+		waited += delay
+
+		// Free the connection for reuse before waiting
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close the request body, as a RoundTripper must even when it fails
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// Whether the request body can be sent again
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// Wait out any hold on key, then take a token
+func (t *Transport) wait(ctx context.Context, key string) error {
+	now := t.clock.Now()
+	t.mu.Lock()
+	t.restore(key, now)
+	until, held := t.holds[key]
+	if held && !until.After(now) {
+		delete(t.holds, key)
+		held = false
+	}
+	t.mu.Unlock()
+
+	if held {
+		if err := t.sleep(ctx, until.Sub(now)); err != nil {
+			return err
+		}
+	}
+	return t.limiter.Wait(ctx, key, 1)
+}
+
+// Sleep on the transport's clock
+func (t *Transport) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := t.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Full jitter: a random duration up to the exponential backoff for attempt
+func (t *Transport) jitter(attempt int) time.Duration {
+	ceiling := t.maxBackoff
+	if attempt < 32 && t.backoff<<attempt < ceiling && t.backoff<<attempt > 0 {
+		ceiling = t.backoff << attempt
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+	return time.Duration(t.rand.Int63n(int64(ceiling) + 1))
+}
+
+// Adjust the limits for key from the server's response headers
+// Returns how long key is held for, if the server asked us to wait.
+func (t *Transport) observe(key string, resp *http.Response) (time.Duration, bool) {
+	now := t.clock.Now()
+	h := resp.Header
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if retryAfter, ok := parseRetryAfter(h.Get("Retry-After"), now); ok {
+		t.hold(key, now.Add(retryAfter))
+	}
+
+	remaining, errRemaining := strconv.Atoi(strings.TrimSpace(h.Get("RateLimit-Remaining")))
+	reset, errReset := strconv.Atoi(strings.TrimSpace(h.Get("RateLimit-Reset")))
+	if errRemaining == nil && errReset == nil && remaining >= 0 && reset > 0 {
+		window := time.Duration(reset) * time.Second
+		if remaining == 0 {
+			t.hold(key, now.Add(window))
+		} else {
+			t.lower(key, remaining, window, now)
+		}
+	}
+
+	until, held := t.holds[key]
+	if !held || !until.After(now) {
+		return 0, false
+	}
+	return until.Sub(now), true
+}
+
+// Hold key until the given time, extending any existing hold
+// Caller must hold t.mu
+func (t *Transport) hold(key string, until time.Time) {
+	if until.After(t.holds[key]) {
+		t.holds[key] = until
+	}
+}
+
+// Lower key's rate to the server's remaining budget until its window resets
+// Does nothing if the local policy is already stricter. Caller must hold t.mu
+func (t *Transport) lower(key string, remaining int, window time.Duration, now time.Time) {
+	l, isLowered := t.lowered[key]
+	if !isLowered {
+		l.prev, l.hadPrev = t.limiter.Policy(key)
+		if !l.hadPrev {
+			l.prev = t.limiter.PolicyFor(key)
+		}
+	}
+
+	local := l.prev
+	if float64(remaining)/window.Seconds() >= float64(local.Rate)/local.Window.Seconds() {
+		// Server allows more than we would send anyway
+		if isLowered {
+			t.unlower(key)
+		}
+		return
+	}
+	p := tokenbucket.NewPolicy(remaining, window, min(remaining, local.BurstSize))
+	if err := t.limiter.SetPolicy(key, p); err != nil {
+		return
+	}
+	l.until = now.Add(window)
+	t.lowered[key] = l
+}
+
+// Put back the policy key had before it was lowered, if the window has reset by now
+// Caller must hold t.mu
+func (t *Transport) restore(key string, now time.Time) {
+	if l, ok := t.lowered[key]; ok && !now.Before(l.until) {
+		t.unlower(key)
+	}
+}
+
+// Caller must hold t.mu
+func (t *Transport) unlower(key string) {
+	l := t.lowered[key]
+	if l.hadPrev {
+		t.limiter.SetPolicy(key, l.prev)
+	} else {
+		t.limiter.RemovePolicy(key)
+	}
+	delete(t.lowered, key)
+}
+
+// Parse a Retry-After header given in delay-seconds or as an HTTP date
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,387 @@
+package httplimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Advance the clock in small steps whenever something is sleeping on it
+// so client waits complete while server round trips run in real time
+func autoAdvance(clock *tokenbucket.FakeClock, step time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			clock.BlockUntil(1)
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			clock.Advance(step)
+		}
+	}()
+	return func() {
+		close(quit)
+		clock.NewTimer(time.Hour) // Wake BlockUntil
+		<-done
+	}
+}
+
+// A client for srv whose transport is limited by limiter
+func limitedClient(srv *httptest.Server, limiter *tokenbucket.TokenBucket, clock tokenbucket.Clock, opts ...TransportOption) *http.Client {
+	opts = append([]TransportOption{WithBase(srv.Client().Transport), WithTransportClock(clock), WithJitterSeed(1)}, opts...)
+	return &http.Client{Transport: NewTransport(limiter, opts...)}
+}
+
+func get(t *testing.T, client *http.Client, url string) int {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTransport_Paces(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(5, time.Second, 5, tokenbucket.WithClock(clock))
+	client := limitedClient(srv, limiter, clock)
+
+	stop := autoAdvance(clock, 10*time.Millisecond)
+	for i := 0; i < 15; i++ {
+		if code := get(t, client, srv.URL); code != http.StatusOK {
+			t.Fatalf("Request %d: status %d", i, code)
+		}
+	}
+	stop()
+
+	// 5 from the burst, then 5 per second
+	if elapsed := clock.Now().Sub(epoch); elapsed < 2*time.Second || elapsed > 2100*time.Millisecond {
+		t.Errorf("15 requests took %v, want 2s", elapsed)
+	}
+	if hits.Load() != 15 {
+		t.Errorf("Server saw %d requests, want 15", hits.Load())
+	}
+}
+
+func TestTransport_FollowsServerLimit(t *testing.T) {
+	// The server allows 2/s; the client would send 100/s if left alone
+	clock := tokenbucket.NewFakeClock(epoch)
+	var denied atomic.Int32
+	server := New(tokenbucket.NewTokenBucket(2, time.Second, 2, tokenbucket.WithClock(clock)), WithClock(clock))
+	srv := httptest.NewServer(server.Handler(okHandler))
+	defer srv.Close()
+	countDenied := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := srv.Client().Transport.RoundTrip(r)
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			denied.Add(1)
+		}
+		return resp, err
+	})
+
+	limiter := tokenbucket.NewTokenBucket(100, time.Second, 100, tokenbucket.WithClock(clock))
+	client := limitedClient(srv, limiter, clock, WithBase(countDenied))
+
+	stop := autoAdvance(clock, 10*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if code := get(t, client, srv.URL); code != http.StatusOK {
+			t.Fatalf("Request %d: status %d", i, code)
+		}
+	}
+	stop()
+
+	if denied.Load() != 0 {
+		t.Errorf("Server denied %d requests, want 0", denied.Load())
+	}
+	if elapsed := clock.Now().Sub(epoch); elapsed < 4*time.Second {
+		t.Errorf("10 requests took %v, faster than the server's 2/s", elapsed)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransport_RetriesAfterRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	client := limitedClient(srv, limiter, clock)
+
+	stop := autoAdvance(clock, 10*time.Millisecond)
+	code := get(t, client, srv.URL)
+	stop()
+
+	if code != http.StatusOK {
+		t.Fatalf("Got status %d after retries, want 200", code)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("Server saw %d attempts, want 3", attempts.Load())
+	}
+	if elapsed := clock.Now().Sub(epoch); elapsed != 4*time.Second {
+		t.Errorf("Retries took %v, want 4s", elapsed)
+	}
+}
+
+func TestTransport_RetryBudget(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(100, time.Second, 100, tokenbucket.WithClock(clock))
+
+	// Plenty of time: stops after the retry count
+	client := limitedClient(srv, limiter, clock, WithRetries(2, time.Minute), WithBackoff(100*time.Millisecond, time.Second))
+	stop := autoAdvance(clock, 10*time.Millisecond)
+	code := get(t, client, srv.URL)
+	if code != http.StatusServiceUnavailable || attempts.Load() != 3 {
+		t.Errorf("Got status %d after %d attempts, want 503 after 3", code, attempts.Load())
+	}
+	// Jittered waits stay under the doubling ceiling: 100ms + 200ms
+	if elapsed := clock.Now().Sub(epoch); elapsed > 300*time.Millisecond {
+		t.Errorf("Backoff took %v, want at most 300ms", elapsed)
+	}
+
+	// Plenty of retries: stops once the waits would exceed the budget
+	attempts.Store(0)
+	start := clock.Now()
+	client = limitedClient(srv, limiter, clock, WithRetries(100, time.Second), WithBackoff(200*time.Millisecond, 400*time.Millisecond))
+	get(t, client, srv.URL)
+	stop()
+	if elapsed := clock.Now().Sub(start); elapsed > time.Second+50*time.Millisecond {
+		t.Errorf("Retries took %v, over the 1s budget", elapsed)
+	}
+	if n := attempts.Load(); n < 3 || n > 50 {
+		t.Errorf("Got %d attempts within the budget", n)
+	}
+}
+
+func TestTransport_GivesUpOnLongRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	client := limitedClient(srv, limiter, clock)
+
+	if code := get(t, client, srv.URL); code != http.StatusTooManyRequests || attempts.Load() != 1 {
+		t.Fatalf("Got status %d after %d attempts, want an immediate 429", code, attempts.Load())
+	}
+
+	// Later requests wait out the hold, until the caller gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Do(req)
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, want context.Canceled", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("Server saw %d attempts during the hold", attempts.Load())
+	}
+}
+
+func TestTransport_ReplaysBody(t *testing.T) {
+	var attempts atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	client := limitedClient(srv, limiter, clock)
+
+	stop := autoAdvance(clock, 10*time.Millisecond)
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Join(bodies, ",") != "hello,hello" {
+		t.Errorf("Got status %d with bodies %q", resp.StatusCode, bodies)
+	}
+
+	// A streamed body cannot be sent twice, so the 503 is returned
+	attempts.Store(0)
+	bodies = nil
+	resp, err = client.Post(srv.URL, "text/plain", io.MultiReader(strings.NewReader("once")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || len(bodies) != 1 {
+		t.Errorf("Got status %d after %d attempts, want 503 after 1", resp.StatusCode, len(bodies))
+	}
+}
+
+// Body that records whether it was closed
+type trackedBody struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func TestTransport_ClosesBodyWhenWaitFails(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(1, time.Minute, 1, tokenbucket.WithClock(clock))
+	limiter.Allow("example.com")
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Error("Request should not be sent without a token")
+		return nil, errors.New("unreachable")
+	})
+	transport := NewTransport(limiter, WithBase(base), WithTransportClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &trackedBody{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.com/", body)
+	go func() {
+		clock.BlockUntil(1) // Waiting for the token
+		cancel()
+	}()
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if !body.closed.Load() {
+		t.Error("RoundTrip should close the request body when it fails")
+	}
+}
+
+func TestTransport_LowersAndRestoresPolicy(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("RateLimit-Remaining", "3")
+			w.Header().Set("RateLimit-Reset", "10")
+		}
+	}))
+	defer srv.Close()
+	host := mustHost(t, srv.URL)
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	client := limitedClient(srv, limiter, clock)
+
+	get(t, client, srv.URL)
+	p, ok := limiter.Policy(host)
+	if want := tokenbucket.NewPolicy(3, 10*time.Second, 3); !ok || p != want {
+		t.Fatalf("Policy for %s = %+v, %v; want %+v", host, p, ok, want)
+	}
+
+	// Another host keeps the default
+	if p := limiter.PolicyFor("example.com"); p.Rate != 10 {
+		t.Errorf("Unrelated host policy = %+v", p)
+	}
+
+	clock.Advance(10 * time.Second)
+	get(t, client, srv.URL)
+	if p, ok := limiter.Policy(host); ok {
+		t.Errorf("Policy for %s not restored: %+v", host, p)
+	}
+}
+
+func TestTransport_KeepsStricterLocalPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", "500")
+		w.Header().Set("RateLimit-Reset", "1")
+	}))
+	defer srv.Close()
+
+	clock := tokenbucket.NewFakeClock(epoch)
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	custom := tokenbucket.NewPolicy(1, time.Second, 1)
+	limiter.SetPolicy("api", custom)
+	client := limitedClient(srv, limiter, clock, WithRequestKey(func(*http.Request) string { return "api" }))
+
+	get(t, client, srv.URL)
+	if p, _ := limiter.Policy("api"); p != custom {
+		t.Errorf("Policy = %+v, want the caller's %+v", p, custom)
+	}
+}
+
+func mustHost(t *testing.T, raw string) string {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := epoch
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package metrics exports rate limiter decisions in the Prometheus text
+// exposition format, without depending on the Prometheus client library.
+//
+//	collector := metrics.New(metrics.WithKeyClass(planOf))
+//	limiter := tokenbucket.NewTokenBucket(100, time.Minute, 20, tokenbucket.WithObserver(collector))
+//	collector.TrackKeys("api", limiter.Stats)
+//	http.Handle("/metrics", collector)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// DefaultRetryAfterBuckets are the upper bounds in seconds of the RetryAfter histogram
+var DefaultRetryAfterBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// Collector counts limiter decisions and serves them to Prometheus
+// It implements tokenbucket.Observer and http.Handler.
+//
+// Exported metrics, with a "class" label when WithKeyClass is set:
+//
+//	ratelimit_requests_total{decision="allowed|denied"}  counter
+//	ratelimit_tokens_consumed_total                      counter
+//	ratelimit_retry_after_seconds                        histogram of denials
+//	ratelimit_tracked_keys{limiter="..."}                gauge, see TrackKeys
+//	ratelimit_evicted_keys_total{limiter="..."}          counter, see TrackKeys
+//
+// Reserve and Wait count as requests when the tokens are taken. Tokens given
+// back later (Refund, a cancelled reservation, a Settle below the Acquire
+// estimate) and Settle overages are not reflected in tokens consumed.
+type Collector struct {
+	namespace string
+	keyClass  func(key string) string
+	buckets   []float64
+
+	mu      sync.Mutex
+	classes map[string]*classMetrics
+	sources []keySource
+}
+
+type classMetrics struct {
+	allowed    uint64
+	denied     uint64
+	tokens     uint64
+	retryAfter histogram
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type keySource struct {
+	limiter string
+	stats   func() tokenbucket.Stats
+}
+
+// Option configures a Collector
+type Option func(*Collector)
+
+// WithKeyClass labels metrics with class(key)
+// Keys themselves are unbounded (IPs, users), so map them to a small set
+// of classes such as plans or endpoints to keep cardinality bounded.
+func WithKeyClass(class func(key string) string) Option {
+	return func(c *Collector) {
+		c.keyClass = class
+	}
+}
+
+// WithNamespace sets the metric name prefix
+// Defaults to "ratelimit"
+func WithNamespace(namespace string) Option {
+	return func(c *Collector) {
+		c.namespace = namespace
+	}
+}
+
+// WithRetryAfterBuckets sets the RetryAfter histogram's upper bounds in seconds
+// Defaults to DefaultRetryAfterBuckets
+func WithRetryAfterBuckets(buckets []float64) Option {
+	return func(c *Collector) {
+		c.buckets = buckets
+	}
+}
+
+// New creates a collector
+func New(opts ...Option) *Collector {
+	c := &Collector{
+		namespace: "ratelimit",
+		buckets:   DefaultRetryAfterBuckets,
+		classes:   make(map[string]*classMetrics),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.buckets = append([]float64(nil), c.buckets...)
+	sort.Float64s(c.buckets)
+	return c
+}
+
+// Observe records a decision, implementing tokenbucket.Observer
+func (c *Collector) Observe(key string, n int, result *tokenbucket.Result) {
+	class := ""
+	if c.keyClass != nil {
+		class = c.keyClass(key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.classes[class]
+	if m == nil {
+		m = &classMetrics{retryAfter: histogram{counts: make([]uint64, len(c.buckets))}}
+		c.classes[class] = m
+	}
+	if result.Allowed {
+		m.allowed++
+		m.tokens += uint64(max(n, 0))
+		return
+	}
+	m.denied++
+	seconds := result.RetryAfter.Seconds()
+	m.retryAfter.sum += seconds
+	m.retryAfter.count++
+	if i := sort.SearchFloat64s(c.buckets, seconds); i < len(c.buckets) {
+		m.retryAfter.counts[i]++
+	}
+}
+
+// TrackKeys exports the key counts of a limiter, e.g. TrackKeys("api", limiter.Stats)
+// Stats are read on every scrape.
+func (c *Collector) TrackKeys(limiter string, stats func() tokenbucket.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources = append(c.sources, keySource{limiter: limiter, stats: stats})
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	// Read limiter stats before taking our lock, they take the limiters' locks
+	c.mu.Lock()
+	sources := append([]keySource(nil), c.sources...)
+	c.mu.Unlock()
+	stats := make([]tokenbucket.Stats, len(sources))
+	for i, src := range sources {
+		stats[i] = src.stats()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	classes := make([]string, 0, len(c.classes))
+	for class := range c.classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	name := c.namespace + "_requests_total"
+	header(cw, name, "counter", "Rate limit decisions.")
+	for _, class := range classes {
+		m := c.classes[class]
+		sample(cw, name, c.labels(class, "decision", "allowed"), float64(m.allowed))
+		sample(cw, name, c.labels(class, "decision", "denied"), float64(m.denied))
+	}
+
+	name = c.namespace + "_tokens_consumed_total"
+	header(cw, name, "counter", "Tokens consumed by allowed requests.")
+	for _, class := range classes {
+		sample(cw, name, c.labels(class), float64(c.classes[class].tokens))
+	}
+
+	name = c.namespace + "_retry_after_seconds"
+	header(cw, name, "histogram", "RetryAfter of denied requests.")
+	for _, class := range classes {
+		h := c.classes[class].retryAfter
+		cumulative := uint64(0)
+		for i, bound := range c.buckets {
+			cumulative += h.counts[i]
+			sample(cw, name+"_bucket", c.labels(class, "le", formatFloat(bound)), float64(cumulative))
+		}
+		sample(cw, name+"_bucket", c.labels(class, "le", "+Inf"), float64(h.count))
+		sample(cw, name+"_sum", c.labels(class), h.sum)
+		sample(cw, name+"_count", c.labels(class), float64(h.count))
+	}
+
+	if len(sources) > 0 {
+		name = c.namespace + "_tracked_keys"
+		header(cw, name, "gauge", "Keys currently tracked by the limiter.")
+		for i, src := range sources {
+			sample(cw, name, labels("limiter", src.limiter), float64(stats[i].Keys))
+		}
+		name = c.namespace + "_evicted_keys_total"
+		header(cw, name, "counter", "Keys evicted by the limiter.")
+		for i, src := range sources {
+			sample(cw, name, labels("limiter", src.limiter), float64(stats[i].Evicted))
+		}
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// Labels for a class-level sample, plus extra name/value pairs
+func (c *Collector) labels(class string, pairs ...string) string {
+	if c.keyClass != nil {
+		pairs = append([]string{"class", class}, pairs...)
+	}
+	return labels(pairs...)
+}
+
+// Format name/value pairs as {name="value",...}
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(pairs[i])
+		sb.WriteString(`="`)
+		sb.WriteString(labelEscaper.Replace(pairs[i+1]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// Label values escape backslash, double quote and newline
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counts bytes written and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCollector_Exposition(t *testing.T) {
+	collector := New(WithRetryAfterBuckets([]float64{1, 0.1}))
+	limiter := tokenbucket.NewTokenBucket(10, time.Second, 2,
+		tokenbucket.WithClock(tokenbucket.NewFakeClock(epoch)),
+		tokenbucket.WithObserver(collector))
+	collector.TrackKeys("api", limiter.Stats)
+
+	limiter.AllowN("user:alice", 2)
+	limiter.Allow("user:alice")     // Denied, RetryAfter 100ms
+	limiter.AllowN("user:alice", 2) // Denied, RetryAfter 200ms
+
+	var sb strings.Builder
+	if _, err := collector.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP ratelimit_requests_total Rate limit decisions.
+# TYPE ratelimit_requests_total counter
+ratelimit_requests_total{decision="allowed"} 1
+ratelimit_requests_total{decision="denied"} 2
+# HELP ratelimit_tokens_consumed_total Tokens consumed by allowed requests.
+# TYPE ratelimit_tokens_consumed_total counter
+ratelimit_tokens_consumed_total 2
+# HELP ratelimit_retry_after_seconds RetryAfter of denied requests.
+# TYPE ratelimit_retry_after_seconds histogram
+ratelimit_retry_after_seconds_bucket{le="0.1"} 1
+ratelimit_retry_after_seconds_bucket{le="1"} 2
+ratelimit_retry_after_seconds_bucket{le="+Inf"} 2
+ratelimit_retry_after_seconds_sum 0.30000000000000004
+ratelimit_retry_after_seconds_count 2
+# HELP ratelimit_tracked_keys Keys currently tracked by the limiter.
+# TYPE ratelimit_tracked_keys gauge
+ratelimit_tracked_keys{limiter="api"} 1
+# HELP ratelimit_evicted_keys_total Keys evicted by the limiter.
+# TYPE ratelimit_evicted_keys_total counter
+ratelimit_evicted_keys_total{limiter="api"} 0
+`
+	if got := sb.String(); got != want {
+		t.Errorf("Unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCollector_KeyClass(t *testing.T) {
+	plan := func(key string) string {
+		if strings.HasPrefix(key, "gold:") {
+			return "gold"
+		}
+		return "free"
+	}
+	collector := New(WithKeyClass(plan), WithNamespace("api_limit"))
+	collector.Observe("gold:acme", 3, &tokenbucket.Result{Allowed: true})
+	collector.Observe("gold:initech", 1, &tokenbucket.Result{Allowed: true})
+	collector.Observe("1.2.3.4", 1, &tokenbucket.Result{RetryAfter: 20 * time.Second})
+
+	var sb strings.Builder
+	collector.WriteTo(&sb)
+	got := sb.String()
+	for _, line := range []string{
+		`api_limit_requests_total{class="free",decision="denied"} 1`,
+		`api_limit_requests_total{class="gold",decision="allowed"} 2`,
+		`api_limit_tokens_consumed_total{class="gold"} 4`,
+		`api_limit_retry_after_seconds_bucket{class="free",le="10"} 0`,
+		`api_limit_retry_after_seconds_bucket{class="free",le="30"} 1`,
+		`api_limit_retry_after_seconds_sum{class="free"} 20`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "tracked_keys") {
+		t.Error("Tracked keys gauge should be omitted without TrackKeys")
+	}
+}
+
+func TestCollector_LabelEscaping(t *testing.T) {
+	collector := New(WithKeyClass(func(key string) string { return key }))
+	collector.Observe("a\"b\\c\nd", 1, &tokenbucket.Result{Allowed: true})
+
+	var sb strings.Builder
+	collector.WriteTo(&sb)
+	if want := `{class="a\"b\\c\nd",decision="allowed"} 1`; !strings.Contains(sb.String(), want) {
+		t.Errorf("Expected escaped label %s in:\n%s", want, sb.String())
+	}
+}
+
+func TestCollector_Handler(t *testing.T) {
+	collector := New()
+	collector.Observe("k", 1, &tokenbucket.Result{Allowed: true})
+
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `ratelimit_requests_total{decision="allowed"} 1`) {
+		t.Errorf("Unexpected body:\n%s", body)
+	}
+}
@@ -0,0 +1,346 @@
+package netlimit
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Listener limits the rate of new connections per IP, per IP prefix and
+// globally, and caps concurrent connections per IP
+// Each admitted connection costs one token from every configured bucket.
+// Connections over a limit are closed as soon as they are accepted and
+// counted in Stats; Accept keeps waiting for one that is admitted.
+type Listener struct {
+	net.Listener
+
+	perIP     *tokenbucket.TokenBucket // Keyed by address
+	perPrefix *tokenbucket.TokenBucket // Keyed by masked prefix
+	v4Bits    int
+	v6Bits    int
+	global    *tokenbucket.TokenBucket // Single key
+	maxPerIP  int                      // 0 = unlimited
+	maxDelay  time.Duration            // Wait this long for tokens instead of rejecting
+	clock     tokenbucket.Clock
+
+	mu    sync.Mutex
+	open  map[netip.Addr]int
+	stats ListenerStats
+}
+
+// ListenerStats are counters for a Listener
+type ListenerStats struct {
+	Accepted    uint64 // Connections returned by Accept
+	Delayed     uint64 // Accepted connections held back until tokens were available
+	RateLimited uint64 // Connections closed for exceeding a rate
+	OverCap     uint64 // Connections closed because their IP had too many open
+	Open        int    // Accepted connections not closed yet
+}
+
+// ListenerOption configures a Listener
+type ListenerOption func(*Listener)
+
+// WithIPRate limits new connections per remote address
+func WithIPRate(tb *tokenbucket.TokenBucket) ListenerOption {
+	return func(l *Listener) {
+		l.perIP = tb
+	}
+}
+
+// WithPrefixRate limits new connections per network, addresses are masked
+// to v4Bits for IPv4 and v6Bits for IPv6 (typically 24 and 64)
+// Catches floods spread over many addresses of one subnet.
+func WithPrefixRate(tb *tokenbucket.TokenBucket, v4Bits, v6Bits int) ListenerOption {
+	return func(l *Listener) {
+		l.perPrefix = tb
+		l.v4Bits = v4Bits
+		l.v6Bits = v6Bits
+	}
+}
+
+// WithGlobalRate limits new connections over all addresses
+func WithGlobalRate(tb *tokenbucket.TokenBucket) ListenerOption {
+	return func(l *Listener) {
+		l.global = tb
+	}
+}
+
+// WithMaxConnsPerIP caps how many accepted connections an address may hold open
+func WithMaxConnsPerIP(n int) ListenerOption {
+	return func(l *Listener) {
+		l.maxPerIP = n
+	}
+}
+
+// WithMaxDelay admits connections whose tokens become available within d
+// instead of closing them. Accept returns them right away, but their first
+// Read or Write blocks until the tokens are due, so one busy address
+// doesn't stall the accept loop.
+func WithMaxDelay(d time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.maxDelay = d
+	}
+}
+
+// WithListenerClock sets the clock used to hold back delayed connections
+// Must match the buckets' clock when they use a fake one
+func WithListenerClock(clock tokenbucket.Clock) ListenerOption {
+	return func(l *Listener) {
+		l.clock = clock
+	}
+}
+
+// NewListener wraps ln with connection admission limits
+func NewListener(ln net.Listener, opts ...ListenerOption) *Listener {
+	l := &Listener{
+		Listener: ln,
+		clock:    tokenbucket.RealClock{},
+		open:     make(map[netip.Addr]int),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Accept waits for and returns the next admitted connection
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteIP(conn.RemoteAddr())
+		if admitted := l.admit(conn, ip); admitted != nil {
+			return admitted, nil
+		}
+		conn.Close()
+	}
+}
+
+// Stats returns the listener's counters
+func (l *Listener) Stats() ListenerStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	for _, n := range l.open {
+		stats.Open += n
+	}
+	return stats
+}
+
+// Check every limit for ip, returns nil if conn must be closed
+func (l *Listener) admit(conn net.Conn, ip netip.Addr) net.Conn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxPerIP > 0 && ip.IsValid() && l.open[ip] >= l.maxPerIP {
+		l.stats.OverCap++
+		return nil
+	}
+
+	// One token from each bucket, all or nothing
+	now := l.clock.Now()
+	limits := l.limits(ip)
+	reservations := make([]*tokenbucket.Reservation, 0, len(limits))
+	readyAt := now
+	for _, limit := range limits {
+		r := limit.Bucket.Reserve(limit.Key, 1)
+		delay := r.DelayFrom(now)
+		if !r.OK() || delay > l.maxDelay {
+			r.Cancel()
+			l.giveBack(limits, reservations, now)
+			l.stats.RateLimited++
+			return nil
+		}
+		reservations = append(reservations, r)
+		if at := now.Add(delay); at.After(readyAt) {
+			readyAt = at
+		}
+	}
+
+	l.stats.Accepted++
+	if readyAt.After(now) {
+		l.stats.Delayed++
+	}
+	if ip.IsValid() {
+		l.open[ip]++
+	}
+	return &admittedConn{
+		Conn:    conn,
+		l:       l,
+		ip:      ip,
+		readyAt: readyAt,
+		closed:  make(chan struct{}),
+	}
+}
+
+// Return the tokens of a rejected connection
+// Cancel only undoes reservations that are not due yet, tokens that were
+// available right away are refunded.
+func (l *Listener) giveBack(limits []Limit, reservations []*tokenbucket.Reservation, now time.Time) {
+	for i, r := range reservations {
+		if r.DelayFrom(now) > 0 {
+			r.Cancel()
+		} else {
+			limits[i].Bucket.Refund(limits[i].Key, 1)
+		}
+	}
+}
+
+// The configured buckets and the key ip is charged under in each
+func (l *Listener) limits(ip netip.Addr) []Limit {
+	var limits []Limit
+	if ip.IsValid() {
+		if l.perIP != nil {
+			limits = append(limits, Limit{l.perIP, ip.String()})
+		}
+		if l.perPrefix != nil {
+			limits = append(limits, Limit{l.perPrefix, prefixKey(ip, l.v4Bits, l.v6Bits)})
+		}
+	}
+	if l.global != nil {
+		limits = append(limits, Limit{l.global, "global"})
+	}
+	return limits
+}
+
+func (l *Listener) release(ip netip.Addr) {
+	if !ip.IsValid() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[ip]--; l.open[ip] <= 0 {
+		delete(l.open, ip)
+	}
+}
+
+// The network ip belongs to, e.g. "192.0.2.0/24"
+func prefixKey(ip netip.Addr, v4Bits, v6Bits int) string {
+	bits := v6Bits
+	if ip.Is4() {
+		bits = v4Bits
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ip.String()
+	}
+	return prefix.String()
+}
+
+// Remote address without port, invalid for non-IP connections (e.g. unix sockets)
+// IPv4-mapped IPv6 addresses are unmapped so they share limits with IPv4.
+func remoteIP(addr net.Addr) netip.Addr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.AddrPort().Addr().Unmap()
+	}
+	if addr == nil {
+		return netip.Addr{}
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// Connection returned by Listener.Accept
+// Frees the IP's connection slot on Close and holds back I/O until the
+// connection's tokens are due, or its read or write deadline passes.
+type admittedConn struct {
+	net.Conn
+	l       *Listener
+	ip      netip.Addr
+	readyAt time.Time
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *admittedConn) Read(p []byte) (int, error) {
+	if err := c.waitReady(&c.readDeadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *admittedConn) Write(p []byte) (int, error) {
+	if err := c.waitReady(&c.writeDeadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *admittedConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *admittedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *admittedConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *admittedConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.l.release(c.ip)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+// Wait until the connection is ready or the deadline passes
+// Deadlines are wall clock times like those of net.Conn, not listener clock times
+func (c *admittedConn) waitReady(deadline *time.Time) error {
+	delay := c.readyAt.Sub(c.l.clock.Now())
+	if delay <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	d := *deadline
+	c.mu.Unlock()
+
+	var expired <-chan time.Time
+	if !d.IsZero() {
+		until := time.Until(d)
+		if until <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		deadlineTimer := time.NewTimer(until)
+		defer deadlineTimer.Stop()
+		expired = deadlineTimer.C
+	}
+
+	timer := c.l.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
@@ -0,0 +1,222 @@
+package netlimit
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Serve l in the background, handing out accepted connections
+func acceptAll(t *testing.T, l *Listener) <-chan net.Conn {
+	t.Helper()
+	conns := make(chan net.Conn, 16)
+	go func() {
+		defer close(conns)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return conns
+}
+
+func listen(t *testing.T, opts ...ListenerOption) (*Listener, <-chan net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(ln, opts...)
+	return l, acceptAll(t, l)
+}
+
+func dial(t *testing.T, l *Listener) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conns <-chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for Accept")
+		return nil
+	}
+}
+
+// A rejected connection is closed by the server, the client reads EOF
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected rejected connection to be closed, got %v", err)
+	}
+}
+
+func waitStats(t *testing.T, l *Listener, ok func(ListenerStats) bool) ListenerStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := l.Stats()
+		if ok(stats) || time.Now().After(deadline) {
+			return stats
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestListener_IPRate(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	perIP := tokenbucket.NewTokenBucket(2, time.Minute, 2, tokenbucket.WithClock(clock))
+	l, conns := listen(t, WithIPRate(perIP), WithListenerClock(clock))
+
+	for i := 0; i < 2; i++ {
+		dial(t, l)
+		receive(t, conns)
+	}
+	expectClosed(t, dial(t, l))
+
+	stats := waitStats(t, l, func(s ListenerStats) bool { return s.RateLimited == 1 })
+	if stats.Accepted != 2 || stats.RateLimited != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// A token refills after 30s
+	clock.Advance(30 * time.Second)
+	dial(t, l)
+	receive(t, conns)
+}
+
+func TestListener_GlobalRateRefundsOnReject(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	perIP := tokenbucket.NewTokenBucket(1, time.Minute, 1, tokenbucket.WithClock(clock))
+	global := tokenbucket.NewTokenBucket(10, time.Minute, 10, tokenbucket.WithClock(clock))
+	l, conns := listen(t, WithIPRate(perIP), WithGlobalRate(global), WithListenerClock(clock))
+
+	dial(t, l)
+	receive(t, conns)
+	expectClosed(t, dial(t, l))
+	waitStats(t, l, func(s ListenerStats) bool { return s.RateLimited == 1 })
+
+	// Only the admitted connection was charged globally
+	if result := global.AllowWithInfo("global", 0); result.Remaining != 9 {
+		t.Errorf("Expected 9 global tokens left, got %d", result.Remaining)
+	}
+}
+
+func TestListener_MaxConnsPerIP(t *testing.T) {
+	l, conns := listen(t, WithMaxConnsPerIP(1))
+
+	dial(t, l)
+	first := receive(t, conns)
+	expectClosed(t, dial(t, l))
+	stats := waitStats(t, l, func(s ListenerStats) bool { return s.OverCap == 1 })
+	if stats.OverCap != 1 || stats.Open != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Closing frees the slot, closing twice frees it once
+	first.Close()
+	first.Close()
+	dial(t, l)
+	receive(t, conns)
+	if stats := l.Stats(); stats.Open != 1 {
+		t.Errorf("Expected 1 open connection, got %d", stats.Open)
+	}
+}
+
+func TestListener_Delay(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	perIP := tokenbucket.NewTokenBucket(1, time.Second, 1, tokenbucket.WithClock(clock))
+	l, conns := listen(t, WithIPRate(perIP), WithMaxDelay(5*time.Second), WithListenerClock(clock))
+
+	dial(t, l)
+	receive(t, conns)
+	client := dial(t, l)
+	server := receive(t, conns)
+	if stats := l.Stats(); stats.Delayed != 1 {
+		t.Errorf("Expected 1 delayed connection, got %+v", stats)
+	}
+
+	client.Write([]byte("x"))
+	read := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	// The read is held back until the token is due
+	clock.BlockUntil(1)
+	select {
+	case <-read:
+		t.Fatal("Read should wait for the connection's token")
+	default:
+	}
+	clock.Advance(time.Second)
+	if err := <-read; err != nil {
+		t.Errorf("Expected read after delay to succeed, got %v", err)
+	}
+}
+
+func TestListener_DelayRespectsDeadlines(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	perIP := tokenbucket.NewTokenBucket(1, time.Second, 1, tokenbucket.WithClock(clock))
+	l, conns := listen(t, WithIPRate(perIP), WithMaxDelay(5*time.Second), WithListenerClock(clock))
+
+	dial(t, l)
+	receive(t, conns)
+	dial(t, l)
+	server := receive(t, conns)
+
+	// The token is never due on the fake clock, the deadline ends the wait
+	server.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := server.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected os.ErrDeadlineExceeded from Read, got %v", err)
+	}
+	server.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := server.Write([]byte("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected os.ErrDeadlineExceeded from Write past its deadline, got %v", err)
+	}
+}
+
+func TestPrefixKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.77", "192.0.2.0/24"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+	}
+	for _, tt := range tests {
+		if got := prefixKey(netip.MustParseAddr(tt.ip), 24, 64); got != tt.want {
+			t.Errorf("prefixKey(%s) = %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	mapped := &net.TCPAddr{IP: net.ParseIP("::ffff:192.0.2.1"), Port: 1234}
+	if got := remoteIP(mapped); got != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("Expected IPv4-mapped address to be unmapped, got %s", got)
+	}
+	if got := remoteIP(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}); got.IsValid() {
+		t.Errorf("Expected no IP for unix socket, got %s", got)
+	}
+}
@@ -0,0 +1,228 @@
+// Package netlimit throttles network traffic with token buckets: byte rates
+// for readers, writers and connections, and connection admission for
+// listeners.
+package netlimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Limit charges bytes to Key in Bucket, one token per byte
+// Limits sharing a bucket and key share a byte budget, so the same Limit on
+// every connection caps aggregate bandwidth while a key per peer caps each
+// peer. The bucket's rate is in bytes per window.
+type Limit struct {
+	Bucket *tokenbucket.TokenBucket
+	Key    string
+}
+
+// Reads and writes are split into chunks no larger than this, so a large
+// buffer doesn't wait for a whole burst worth of tokens at once
+const maxChunk = 32 * 1024
+
+// Size of the next chunk: no more than any bucket can hold at once
+func chunkSize(limits []Limit, n int) int {
+	n = min(n, maxChunk)
+	for _, l := range limits {
+		n = min(n, l.Bucket.PolicyFor(l.Key).BurstSize)
+	}
+	return max(n, 1)
+}
+
+// Wait for n tokens from every limit
+// If a later limit fails, tokens already taken from earlier ones are refunded
+func wait(ctx context.Context, limits []Limit, n int) error {
+	for i, l := range limits {
+		if err := l.Bucket.Wait(ctx, l.Key, n); err != nil {
+			for _, taken := range limits[:i] {
+				taken.Bucket.Refund(taken.Key, n)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader throttles reads from an io.Reader
+// Bytes are charged after they are read, so a read returns as soon as data
+// arrives and the next read is held back until the budget recovers.
+type Reader struct {
+	r      io.Reader
+	ctx    context.Context
+	limits []Limit
+}
+
+// NewReader throttles r to all limits
+// Waiting for tokens stops with ctx's error when ctx is done.
+func NewReader(ctx context.Context, r io.Reader, limits ...Limit) *Reader {
+	return &Reader{r: r, ctx: ctx, limits: limits}
+}
+
+// Read reads at most one chunk and waits until the bytes read are paid for
+func (r *Reader) Read(p []byte) (int, error) {
+	return throttledRead(r.ctx, r.r, r.limits, p)
+}
+
+func throttledRead(ctx context.Context, r io.Reader, limits []Limit, p []byte) (int, error) {
+	if len(p) == 0 || len(limits) == 0 {
+		return r.Read(p)
+	}
+	n, err := r.Read(p[:chunkSize(limits, len(p))])
+	if n > 0 {
+		if werr := wait(ctx, limits, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// Writer throttles writes to an io.Writer
+// Each chunk waits for its tokens before it is written.
+type Writer struct {
+	w      io.Writer
+	ctx    context.Context
+	limits []Limit
+}
+
+// NewWriter throttles w to all limits
+// Waiting for tokens stops with ctx's error when ctx is done.
+func NewWriter(ctx context.Context, w io.Writer, limits ...Limit) *Writer {
+	return &Writer{w: w, ctx: ctx, limits: limits}
+}
+
+// Write writes p in chunks, waiting for tokens before each one
+func (w *Writer) Write(p []byte) (int, error) {
+	return throttledWrite(w.ctx, w.w, w.limits, p)
+}
+
+func throttledWrite(ctx context.Context, w io.Writer, limits []Limit, p []byte) (int, error) {
+	if len(limits) == 0 {
+		return w.Write(p)
+	}
+	written := 0
+	for written < len(p) {
+		chunk := chunkSize(limits, len(p)-written)
+		if err := wait(ctx, limits, chunk); err != nil {
+			return written, err
+		}
+		n, err := w.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			// Give back the tokens for bytes that never went out
+			for _, l := range limits {
+				l.Bucket.Refund(l.Key, chunk-n)
+			}
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ConnLimits are the limits applied to each direction of a Conn
+type ConnLimits struct {
+	Read  []Limit
+	Write []Limit
+}
+
+// Conn is a net.Conn with throttled reads and writes
+// Waiting for tokens respects the read and write deadlines, and Close
+// interrupts any wait in progress.
+type Conn struct {
+	net.Conn
+	limits ConnLimits
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewConn throttles conn
+// A typical peer connection gets a per-peer limit and a shared aggregate one:
+//
+//	perPeer := tokenbucket.NewTokenBucket(64<<10, time.Second, 64<<10)
+//	total := tokenbucket.NewTokenBucket(1<<20, time.Second, 256<<10)
+//	conn = netlimit.NewConn(conn, netlimit.ConnLimits{
+//	    Write: []netlimit.Limit{{Bucket: perPeer, Key: peerID}, {Bucket: total, Key: "upload"}},
+//	})
+func NewConn(conn net.Conn, limits ConnLimits) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Conn{Conn: conn, limits: limits, ctx: ctx, cancel: cancel}
+}
+
+// Read implements net.Conn
+func (c *Conn) Read(p []byte) (int, error) {
+	ctx, cancel := c.waitContext(&c.readDeadline)
+	defer cancel()
+	n, err := throttledRead(ctx, c.Conn, c.limits.Read, p)
+	return n, c.mapError(err)
+}
+
+// Write implements net.Conn
+func (c *Conn) Write(p []byte) (int, error) {
+	ctx, cancel := c.waitContext(&c.writeDeadline)
+	defer cancel()
+	n, err := throttledWrite(ctx, c.Conn, c.limits.Write, p)
+	return n, c.mapError(err)
+}
+
+// Close closes the connection and stops any wait for tokens
+func (c *Conn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
+
+// SetDeadline implements net.Conn
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.Conn
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// Context for waiting on tokens, ending at the deadline if one is set
+func (c *Conn) waitContext(deadline *time.Time) (context.Context, context.CancelFunc) {
+	c.mu.Lock()
+	d := *deadline
+	c.mu.Unlock()
+	if d.IsZero() {
+		return context.WithCancel(c.ctx)
+	}
+	return context.WithDeadline(c.ctx, d)
+}
+
+// Report wait failures the way net.Conn does
+func (c *Conn) mapError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return os.ErrDeadlineExceeded
+	case errors.Is(err, context.Canceled) && c.ctx.Err() != nil:
+		return net.ErrClosed
+	}
+	return err
+}
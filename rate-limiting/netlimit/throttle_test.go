@@ -0,0 +1,184 @@
+package netlimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Run fn in a goroutine, advancing the clock by step each time it waits
+// Returns how much fake time fn took
+func drive(t *testing.T, clock *tokenbucket.FakeClock, waits int, step time.Duration, fn func()) time.Duration {
+	t.Helper()
+	start := clock.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	for i := 0; i < waits; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(step)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for throttled I/O")
+	}
+	return clock.Now().Sub(start)
+}
+
+func TestReader_Throttles(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	bucket := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	data := strings.Repeat("x", 100)
+	r := NewReader(context.Background(), strings.NewReader(data), Limit{bucket, "peer"})
+
+	var got []byte
+	var err error
+	// First 10 bytes are covered by the burst, then 10 bytes per second
+	elapsed := drive(t, clock, 9, time.Second, func() {
+		got, err = io.ReadAll(r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("Data corrupted: got %d bytes", len(got))
+	}
+	if elapsed != 9*time.Second {
+		t.Errorf("Expected 100 bytes at 10 B/s with burst 10 to take 9s, took %v", elapsed)
+	}
+}
+
+func TestWriter_Throttles(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	bucket := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	var buf bytes.Buffer
+	w := NewWriter(context.Background(), &buf, Limit{bucket, "peer"})
+
+	var n int
+	var err error
+	elapsed := drive(t, clock, 4, time.Second, func() {
+		n, err = w.Write(make([]byte, 50))
+	})
+	if err != nil || n != 50 || buf.Len() != 50 {
+		t.Fatalf("Write returned %d, %v with %d bytes written", n, err, buf.Len())
+	}
+	if elapsed != 4*time.Second {
+		t.Errorf("Expected 50 bytes to take 4s, took %v", elapsed)
+	}
+}
+
+func TestWriter_SharedAggregate(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	perPeer := tokenbucket.NewTokenBucket(100, time.Hour, 100, tokenbucket.WithClock(clock))
+	total := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+
+	var a, b bytes.Buffer
+	wa := NewWriter(context.Background(), &a, Limit{perPeer, "a"}, Limit{total, "upload"})
+	wb := NewWriter(context.Background(), &b, Limit{perPeer, "b"}, Limit{total, "upload"})
+
+	// Each peer is far below its own limit, but together they share 10 B/s
+	elapsed := drive(t, clock, 3, time.Second, func() {
+		wa.Write(make([]byte, 20))
+		wb.Write(make([]byte, 20))
+	})
+	if a.Len() != 20 || b.Len() != 20 {
+		t.Fatalf("Expected 20 bytes each, got %d and %d", a.Len(), b.Len())
+	}
+	if elapsed != 3*time.Second {
+		t.Errorf("Expected 40 bytes through a 10 B/s aggregate to take 3s, took %v", elapsed)
+	}
+	if result := perPeer.AllowWithInfo("b", 0); result.Remaining != 80 {
+		t.Errorf("Expected per-peer budget of b to be charged 20 bytes, got %d remaining", result.Remaining)
+	}
+}
+
+func TestWriter_ContextCancelled(t *testing.T) {
+	bucket := tokenbucket.NewTokenBucket(1, time.Hour, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	n, err := NewWriter(ctx, &buf, Limit{bucket, "peer"}).Write([]byte("hello"))
+	if !errors.Is(err, context.Canceled) || n != 0 {
+		t.Errorf("Expected context.Canceled with nothing written, got %d, %v", n, err)
+	}
+	if !bucket.AllowN("peer", 5) {
+		t.Error("Cancelled write should not consume tokens")
+	}
+}
+
+func TestConn_Throttles(t *testing.T) {
+	clock := tokenbucket.NewFakeClock(epoch)
+	bucket := tokenbucket.NewTokenBucket(10, time.Second, 10, tokenbucket.WithClock(clock))
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client, ConnLimits{Write: []Limit{{bucket, "up"}}})
+	defer conn.Close()
+	go io.Copy(io.Discard, server)
+
+	elapsed := drive(t, clock, 2, time.Second, func() {
+		conn.Write(make([]byte, 30))
+	})
+	if elapsed != 2*time.Second {
+		t.Errorf("Expected 30 bytes to take 2s, took %v", elapsed)
+	}
+}
+
+func TestConn_WriteDeadline(t *testing.T) {
+	bucket := tokenbucket.NewTokenBucket(1, time.Hour, 5)
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+
+	conn := NewConn(client, ConnLimits{Write: []Limit{{bucket, "up"}}})
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+
+	// The second chunk would need an hour of refill
+	n, err := conn.Write(make([]byte, 10))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected os.ErrDeadlineExceeded, got %v", err)
+	}
+	if n != 5 {
+		t.Errorf("Expected the first 5 bytes to be written, got %d", n)
+	}
+}
+
+func TestConn_CloseInterruptsWait(t *testing.T) {
+	bucket := tokenbucket.NewTokenBucket(1, time.Hour, 1)
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+
+	conn := NewConn(client, ConnLimits{Write: []Limit{{bucket, "up"}}})
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(make([]byte, 2))
+		errc <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Expected net.ErrClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not interrupt the write")
+	}
+}
@@ -0,0 +1,124 @@
+package redisstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RESP (REdis Serialization Protocol) encoding
+// https://redis.io/docs/latest/develop/reference/protocol-spec/
+//
+// Commands are sent as arrays of bulk strings:
+//
+//	*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n
+//
+// Replies start with a type byte:
+//
+//	+ simple string, - error, : integer, $ bulk string, * array
+
+// Error is an error reply sent by the server (e.g. "ERR unknown command")
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// WriteCommand writes a command as a RESP array of bulk strings
+// Does not flush w
+func WriteCommand(w *bufio.Writer, args ...string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	// bufio.Writer keeps the first error, so checking once at the end is enough
+	_, err := w.Write(nil)
+	return err
+}
+
+// ReadReply reads one RESP value
+// Types map to Go as: simple string -> string, error -> Error,
+// integer -> int64, bulk string -> string (nil if null), array -> []any (nil if null)
+// An error reply is returned as the value, not as err, so it can sit inside arrays.
+func ReadReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2) // Payload + CRLF
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = ReadReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+	}
+}
+
+// ReadCommand reads a command sent by a client (an array of bulk strings)
+// Used by servers such as resptest
+func ReadCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := ReadReply(r)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, errors.New("redis: command is not an array")
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		if args[i], ok = item.(string); !ok {
+			return nil, errors.New("redis: command argument is not a string")
+		}
+	}
+	return args, nil
+}
+
+// Read a line without the trailing CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("redis: line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
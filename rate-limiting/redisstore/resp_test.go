@@ -0,0 +1,73 @@
+package redisstore
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := WriteCommand(w, "SET", "k", "hello world"); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	want := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$11\r\nhello world\r\n"
+	if buf.String() != want {
+		t.Errorf("WriteCommand = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{"+OK\r\n", "OK"},
+		{"-ERR boom\r\n", Error("ERR boom")},
+		{":42\r\n", int64(42)},
+		{"$5\r\nhello\r\n", "hello"},
+		{"$0\r\n\r\n", ""},
+		{"$-1\r\n", nil},
+		{"*-1\r\n", nil},
+		{"*2\r\n+OK\r\n$3\r\nfoo\r\n", []any{"OK", "foo"}},
+		{"*1\r\n*1\r\n:1\r\n", []any{[]any{int64(1)}}},
+	}
+
+	for _, tc := range tests {
+		got, err := ReadReply(bufio.NewReader(strings.NewReader(tc.input)))
+		if err != nil {
+			t.Errorf("ReadReply(%q) error: %v", tc.input, err)
+			continue
+		}
+		// A null reply must be an untyped nil so callers can compare with nil
+		if tc.want == nil && got != nil {
+			t.Errorf("ReadReply(%q) = %#v, want nil", tc.input, got)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ReadReply(%q) = %#v, want %#v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestReadReply_Malformed(t *testing.T) {
+	for _, input := range []string{"", "?what\r\n", "+no crlf\n", "$10\r\nshort\r\n", ":nan\r\n"} {
+		if _, err := ReadReply(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("ReadReply(%q) should fail", input)
+		}
+	}
+}
+
+func TestStateEncoding(t *testing.T) {
+	if _, err := decodeState("garbage"); err == nil {
+		t.Error("decodeState should reject malformed values")
+	}
+	if _, err := decodeState("1.5 notanumber"); err == nil {
+		t.Error("decodeState should reject a malformed timestamp")
+	}
+}
@@ -0,0 +1,303 @@
+// Package resptest provides a small in-memory server speaking the Redis RESP
+// protocol, for testing redisstore on loopback without a real Redis.
+// In the spirit of net/http/httptest.
+//
+// Supported commands: PING, GET, SET (with EX/PX), DEL, WATCH, UNWATCH,
+// MULTI, EXEC and DISCARD. Transactions have Redis semantics: EXEC returns a
+// null array if any WATCHed key was written after it was watched.
+package resptest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaldun-tech/go-algorithm-practice/rate-limiting/redisstore"
+)
+
+// Server is a RESP server listening on a loopback port
+type Server struct {
+	// Addr is the host:port the server listens on
+	Addr string
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu        sync.Mutex
+	data      map[string]entry
+	versions  map[string]uint64 // Bumped on every write to a key, survives deletes
+	conns     map[net.Conn]struct{}
+	conflicts int
+}
+
+type entry struct {
+	value     string
+	expiresAt time.Time // Zero for no expiry
+}
+
+// Per-connection transaction state
+type session struct {
+	watched map[string]uint64 // Key -> version when watched
+	multi   bool
+	queued  [][]string
+}
+
+// NewServer starts a server on 127.0.0.1 with a random port
+// Panics if it cannot listen, like httptest.NewServer
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("resptest: failed to listen: %v", err))
+	}
+	s := &Server{
+		Addr:     ln.Addr().String(),
+		ln:       ln,
+		data:     make(map[string]entry),
+		versions: make(map[string]uint64),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server and closes all client connections
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Get returns the value stored under key, ignoring expiry
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	return e.value, ok
+}
+
+// TTL returns the remaining time to live of key (0 if none or missing)
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if !ok || e.expiresAt.IsZero() {
+		return 0
+	}
+	return time.Until(e.expiresAt)
+}
+
+// Conflicts returns how many transactions were aborted because a watched key changed
+func (s *Server) Conflicts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conflicts
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// Serve one client connection until it disconnects
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	sess := &session{watched: make(map[string]uint64)}
+	for {
+		args, err := redisstore.ReadCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			writeError(w, "ERR empty command")
+		} else {
+			s.dispatch(w, sess, args)
+		}
+		// Flush once the client has no more pipelined commands buffered
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Handle transaction commands and queue or execute everything else
+func (s *Server) dispatch(w *bufio.Writer, sess *session, args []string) {
+	switch strings.ToUpper(args[0]) {
+	case "MULTI":
+		if sess.multi {
+			writeError(w, "ERR MULTI calls can not be nested")
+			return
+		}
+		sess.multi = true
+		writeSimple(w, "OK")
+	case "EXEC":
+		if !sess.multi {
+			writeError(w, "ERR EXEC without MULTI")
+			return
+		}
+		s.exec(w, sess)
+	case "DISCARD":
+		if !sess.multi {
+			writeError(w, "ERR DISCARD without MULTI")
+			return
+		}
+		sess.multi, sess.queued = false, nil
+		clear(sess.watched)
+		writeSimple(w, "OK")
+	case "WATCH":
+		if sess.multi {
+			writeError(w, "ERR WATCH inside MULTI is not allowed")
+			return
+		}
+		s.mu.Lock()
+		for _, key := range args[1:] {
+			sess.watched[key] = s.versions[key]
+		}
+		s.mu.Unlock()
+		writeSimple(w, "OK")
+	case "UNWATCH":
+		clear(sess.watched)
+		writeSimple(w, "OK")
+	default:
+		if sess.multi {
+			sess.queued = append(sess.queued, args)
+			writeSimple(w, "QUEUED")
+			return
+		}
+		s.mu.Lock()
+		s.run(w, args)
+		s.mu.Unlock()
+	}
+}
+
+// Run a queued transaction atomically, unless a watched key changed
+func (s *Server) exec(w *bufio.Writer, sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := sess.queued
+	sess.multi, sess.queued = false, nil
+	defer clear(sess.watched)
+
+	for key, version := range sess.watched {
+		if s.versions[key] != version {
+			s.conflicts++
+			w.WriteString("*-1\r\n")
+			return
+		}
+	}
+	fmt.Fprintf(w, "*%d\r\n", len(queued))
+	for _, args := range queued {
+		s.run(w, args)
+	}
+}
+
+// Execute a single data command, caller holds s.mu
+func (s *Server) run(w *bufio.Writer, args []string) {
+	now := time.Now()
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		writeSimple(w, "PONG")
+	case "GET":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'get' command")
+			return
+		}
+		e, ok := s.lookup(args[1], now)
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.value), e.value)
+	case "SET":
+		s.set(w, args, now)
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(key, now); ok {
+				delete(s.data, key)
+				s.versions[key]++
+				deleted++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// SET key value [EX seconds | PX milliseconds]
+func (s *Server) set(w *bufio.Writer, args []string, now time.Time) {
+	if len(args) != 3 && len(args) != 5 {
+		writeError(w, "ERR syntax error")
+		return
+	}
+	e := entry{value: args[2]}
+	if len(args) == 5 {
+		n, err := strconv.ParseInt(args[4], 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, "ERR invalid expire time in 'set' command")
+			return
+		}
+		switch strings.ToUpper(args[3]) {
+		case "EX":
+			e.expiresAt = now.Add(time.Duration(n) * time.Second)
+		case "PX":
+			e.expiresAt = now.Add(time.Duration(n) * time.Millisecond)
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+	s.data[args[1]] = e
+	s.versions[args[1]]++
+	writeSimple(w, "OK")
+}
+
+// Find a live entry, dropping it if it has expired
+func (s *Server) lookup(key string, now time.Time) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+		delete(s.data, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
@@ -0,0 +1,273 @@
+package redisstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+// Store is a tokenbucket.Store backed by a Redis (or RESP compatible) server
+//
+// Each Update is an optimistic transaction: WATCH the key, GET the state,
+// run the refill-and-consume function locally, then MULTI / SET / EXEC.
+// If another client wrote the key in between, EXEC returns null and the
+// whole thing is retried. This needs no server-side scripting, so it works
+// with any server implementing the transaction commands.
+//
+// State is stored as "<tokens> <last refill unix nanos>" with a PX expiry.
+type Store struct {
+	addr        string
+	prefix      string
+	maxRetries  int
+	dialTimeout time.Duration
+	opTimeout   time.Duration // Deadline for one Update or Delete (0 = none)
+	pool        chan *conn    // Idle connections
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+// ErrConflict is returned when an update kept losing the race for a key
+var ErrConflict = errors.New("redisstore: too many conflicting updates")
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithPrefix namespaces all keys, e.g. "ratelimit:"
+func WithPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// WithMaxRetries sets how many times a conflicting transaction is retried (default 10)
+func WithMaxRetries(n int) Option {
+	return func(s *Store) {
+		s.maxRetries = n
+	}
+}
+
+// WithPoolSize sets how many idle connections are kept (default 8)
+func WithPoolSize(n int) Option {
+	return func(s *Store) {
+		s.pool = make(chan *conn, n)
+	}
+}
+
+// WithTimeout bounds how long one Update or Delete may take, retries included
+// (default 1s, 0 disables it). A stalled server then fails the call instead of
+// blocking the caller, so fail-open or fail-closed applies. Also bounds the dial.
+func WithTimeout(d time.Duration) Option {
+	return func(s *Store) {
+		s.opTimeout = d
+		if d > 0 {
+			s.dialTimeout = d
+		}
+	}
+}
+
+// New creates a store talking to the server at addr (host:port)
+// Connections are dialed lazily and pooled; call Close when done.
+func New(addr string, opts ...Option) *Store {
+	s := &Store{
+		addr:        addr,
+		maxRetries:  10,
+		dialTimeout: time.Second,
+		opTimeout:   time.Second,
+		pool:        make(chan *conn, 8),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Update runs fn on the state for key inside a WATCH/MULTI/EXEC transaction
+func (s *Store) Update(key string, ttl time.Duration, fn func(state *tokenbucket.BucketState, found bool) bool) error {
+	c, err := s.get()
+	if err != nil {
+		return err
+	}
+	if err := s.deadline(c); err != nil {
+		c.nc.Close()
+		return err
+	}
+	key = s.prefix + key
+
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		committed, err := s.tryUpdate(c, key, ttl, fn)
+		if err != nil {
+			// Connection state is unknown after an error, don't reuse it
+			c.nc.Close()
+			return err
+		}
+		if committed {
+			s.put(c)
+			return nil
+		}
+	}
+	s.put(c)
+	return ErrConflict
+}
+
+// One optimistic attempt. Returns false if EXEC was aborted by a conflict.
+func (s *Store) tryUpdate(c *conn, key string, ttl time.Duration, fn func(*tokenbucket.BucketState, bool) bool) (bool, error) {
+	if _, err := c.do("WATCH", key); err != nil {
+		return false, err
+	}
+	reply, err := c.do("GET", key)
+	if err != nil {
+		return false, err
+	}
+
+	var state tokenbucket.BucketState
+	found := reply != nil
+	if found {
+		value, _ := reply.(string)
+		if state, err = decodeState(value); err != nil {
+			return false, err
+		}
+	}
+
+	if !fn(&state, found) {
+		_, err := c.do("UNWATCH")
+		return true, err
+	}
+
+	// Pipeline the transaction: +OK, +QUEUED, then EXEC's array (or null on conflict)
+	set := []string{"SET", key, encodeState(state)}
+	if ttl > 0 {
+		set = append(set, "PX", strconv.FormatInt(ttl.Milliseconds()+1, 10))
+	}
+	WriteCommand(c.w, "MULTI")
+	WriteCommand(c.w, set...)
+	WriteCommand(c.w, "EXEC")
+	if err := c.w.Flush(); err != nil {
+		return false, err
+	}
+	// Always drain all three replies so the connection stays in sync
+	var replyErr error
+	for i := 0; i < 3; i++ {
+		if reply, err = ReadReply(c.r); err != nil {
+			return false, err
+		}
+		if e, ok := reply.(Error); ok && replyErr == nil {
+			replyErr = e
+		}
+	}
+	if replyErr != nil {
+		return false, replyErr
+	}
+	return reply != nil, nil
+}
+
+// Delete removes the state for key
+func (s *Store) Delete(key string) error {
+	c, err := s.get()
+	if err != nil {
+		return err
+	}
+	if err := s.deadline(c); err != nil {
+		c.nc.Close()
+		return err
+	}
+	if _, err := c.do("DEL", s.prefix+key); err != nil {
+		c.nc.Close()
+		return err
+	}
+	s.put(c)
+	return nil
+}
+
+// Close closes all idle connections
+func (s *Store) Close() error {
+	for {
+		select {
+		case c := <-s.pool:
+			c.nc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Take an idle connection or dial a new one
+func (s *Store) get() (*conn, error) {
+	select {
+	case c := <-s.pool:
+		return c, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", s.addr, s.dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
+
+// Set the deadline for the operation starting on c
+// Pooled connections carry the previous operation's deadline, so it is
+// replaced (or cleared without a timeout) every time.
+func (s *Store) deadline(c *conn) error {
+	var d time.Time
+	if s.opTimeout > 0 {
+		d = time.Now().Add(s.opTimeout)
+	}
+	return c.nc.SetDeadline(d)
+}
+
+// Return a connection to the pool, closing it if the pool is full
+func (s *Store) put(c *conn) {
+	select {
+	case s.pool <- c:
+	default:
+		c.nc.Close()
+	}
+}
+
+// Send a command and read its reply, turning error replies into errors
+func (c *conn) do(args ...string) (any, error) {
+	if err := WriteCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := ReadReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func encodeState(state tokenbucket.BucketState) string {
+	return strconv.FormatFloat(state.Tokens, 'g', -1, 64) + " " + strconv.FormatInt(state.LastRefill.UnixNano(), 10)
+}
+
+func decodeState(value string) (tokenbucket.BucketState, error) {
+	tokens, nanos, ok := strings.Cut(value, " ")
+	if !ok {
+		return tokenbucket.BucketState{}, fmt.Errorf("redisstore: malformed state %q", value)
+	}
+	t, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return tokenbucket.BucketState{}, fmt.Errorf("redisstore: malformed tokens %q", tokens)
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return tokenbucket.BucketState{}, fmt.Errorf("redisstore: malformed timestamp %q", nanos)
+	}
+	return tokenbucket.BucketState{Tokens: t, LastRefill: time.Unix(0, n)}, nil
+}
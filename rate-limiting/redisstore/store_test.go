@@ -0,0 +1,192 @@
+package redisstore_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaldun-tech/go-algorithm-practice/rate-limiting/redisstore"
+	"github.com/kaldun-tech/go-algorithm-practice/rate-limiting/redisstore/resptest"
+	tokenbucket "github.com/kaldun-tech/go-algorithm-practice/rate-limiting/token-bucket"
+)
+
+func TestStore_SharedQuotaAcrossReplicas(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+
+	// Two replicas, each with its own connection pool
+	storeA := redisstore.New(srv.Addr)
+	defer storeA.Close()
+	storeB := redisstore.New(srv.Addr)
+	defer storeB.Close()
+	replicaA := tokenbucket.NewStoreTokenBucket(storeA, 10, time.Minute, 10)
+	replicaB := tokenbucket.NewStoreTokenBucket(storeB, 10, time.Minute, 10)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if replicaA.Allow("user:alice") {
+			allowed++
+		}
+		if replicaB.Allow("user:alice") {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("Expected 10 requests allowed across replicas, got %d", allowed)
+	}
+}
+
+func TestStore_ConcurrentUpdatesAreAtomic(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+	store := redisstore.New(srv.Addr, redisstore.WithMaxRetries(1000))
+	defer store.Close()
+
+	// Slow refill so no tokens come back during the test
+	limiter := tokenbucket.NewStoreTokenBucket(store, 100, time.Hour, 100)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				result, err := limiter.Take("user:bob", 1)
+				if err != nil {
+					t.Errorf("Take failed: %v", err)
+					return
+				}
+				if result.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 100 {
+		t.Errorf("Expected exactly 100 allowed, got %d (%d conflicts retried)", allowed, srv.Conflicts())
+	}
+}
+
+func TestStore_PrefixAndTTL(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+	store := redisstore.New(srv.Addr, redisstore.WithPrefix("rl:"))
+	defer store.Close()
+
+	// Empty bucket refills in 10 tokens / (10 per minute) = 1 minute
+	limiter := tokenbucket.NewStoreTokenBucket(store, 10, time.Minute, 10)
+	limiter.AllowN("user:charlie", 3)
+
+	value, ok := srv.Get("rl:user:charlie")
+	if !ok {
+		t.Fatal("State should be stored under the prefixed key")
+	}
+	if !strings.HasPrefix(value, "7 ") {
+		t.Errorf("Expected 7 tokens stored, got %q", value)
+	}
+	if ttl := srv.TTL("rl:user:charlie"); ttl <= 59*time.Second || ttl > time.Minute+time.Second {
+		t.Errorf("Expected a TTL of about a minute, got %v", ttl)
+	}
+
+	limiter.Reset("user:charlie")
+	if _, ok := srv.Get("rl:user:charlie"); ok {
+		t.Error("Reset should delete the key")
+	}
+}
+
+func TestStore_ServerDown(t *testing.T) {
+	srv := resptest.NewServer()
+	addr := srv.Addr
+	srv.Close()
+
+	store := redisstore.New(addr)
+	limiter := tokenbucket.NewStoreTokenBucket(store, 10, time.Second, 10)
+	if _, err := limiter.Take("user:dave", 1); err == nil {
+		t.Error("Take should fail when the server is unreachable")
+	}
+	if limiter.Allow("user:dave") {
+		t.Error("Limiter should fail closed")
+	}
+}
+
+func TestStore_Timeout(t *testing.T) {
+	// A server that accepts connections but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var conns []net.Conn
+	var mu sync.Mutex
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+	}()
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+
+	store := redisstore.New(ln.Addr().String(), redisstore.WithTimeout(50*time.Millisecond))
+	defer store.Close()
+
+	start := time.Now()
+	closed := tokenbucket.NewStoreTokenBucket(store, 10, time.Second, 10)
+	if closed.Allow("user:frank") {
+		t.Error("Stalled server should fail closed")
+	}
+	open := tokenbucket.NewStoreTokenBucket(store, 10, time.Second, 10, tokenbucket.WithFailOpen())
+	if !open.Allow("user:frank") {
+		t.Error("Stalled server should fail open with WithFailOpen")
+	}
+	if err := store.Delete("user:frank"); err == nil {
+		t.Error("Delete should time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Calls should give up after the timeout, took %v", elapsed)
+	}
+}
+
+func TestStore_CorruptState(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+
+	// Write garbage under the key through the raw protocol
+	conn, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(conn)
+	redisstore.WriteCommand(w, "SET", "user:eve", "garbage")
+	w.Flush()
+	if reply, err := redisstore.ReadReply(bufio.NewReader(conn)); err != nil || reply != "OK" {
+		t.Fatalf("SET failed: %v %v", reply, err)
+	}
+	conn.Close()
+
+	store := redisstore.New(srv.Addr)
+	defer store.Close()
+	limiter := tokenbucket.NewStoreTokenBucket(store, 10, time.Second, 10)
+	if _, err := limiter.Take("user:eve", 1); err == nil {
+		t.Error("Take should report malformed state")
+	}
+}
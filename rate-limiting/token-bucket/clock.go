@@ -0,0 +1,156 @@
+package tokenbucket
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so limiters can be tested deterministically
+// and production traffic traces can be replayed faster than real time
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTimer creates a Timer that fires once after d
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the subset of time.Timer used by the limiters
+type Timer interface {
+	// C returns the channel the current time is sent on when the timer fires
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing
+	// Returns false if the timer already fired or was stopped
+	Stop() bool
+}
+
+// RealClock is the Clock backed by the time package
+type RealClock struct{}
+
+// Now returns time.Now()
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer wraps time.NewTimer
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (rt realTimer) C() <-chan time.Time {
+	return rt.t.C
+}
+
+func (rt realTimer) Stop() bool {
+	return rt.t.Stop()
+}
+
+// FakeClock is a manually advanced Clock for tests and simulations
+// Time only moves when Advance or Set is called. Timers fire synchronously
+// during Advance/Set, in deadline order.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // Signalled when timers are added
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a fake clock starting at start
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the fake current time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer that fires once the clock is advanced past d
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{
+		clock:    c,
+		deadline: c.now.Add(d),
+		ch:       make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		// Like time.NewTimer, a non-positive duration fires immediately
+		t.ch <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing any timers that come due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t, firing any timers that come due
+// Setting the clock backwards is allowed but fires nothing
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+	sort.Slice(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+	fired := 0
+	for _, timer := range c.timers {
+		if timer.deadline.After(t) {
+			break
+		}
+		timer.ch <- t
+		fired++
+	}
+	c.timers = c.timers[fired:]
+}
+
+// BlockUntil blocks until at least n timers are waiting on the clock
+// Lets a test wait for a goroutine to start sleeping before advancing time
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock_Advance(t *testing.T) {
+	clock := NewFakeClock(epoch)
+
+	clock.Advance(90 * time.Minute)
+	if want := epoch.Add(90 * time.Minute); !clock.Now().Equal(want) {
+		t.Errorf("Now() = %v, want %v", clock.Now(), want)
+	}
+
+	// Jumping to a trace timestamp
+	next := epoch.Add(24 * time.Hour)
+	clock.Set(next)
+	if !clock.Now().Equal(next) {
+		t.Errorf("Now() = %v, want %v", clock.Now(), next)
+	}
+}
+
+func TestFakeClock_TimersFireInOrder(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	late := clock.NewTimer(2 * time.Second)
+	early := clock.NewTimer(time.Second)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-early.C():
+		t.Fatal("Timer fired before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case fired := <-early.C():
+		if !fired.Equal(epoch.Add(time.Second)) {
+			t.Errorf("Timer sent %v, want the fake time", fired)
+		}
+	default:
+		t.Fatal("Timer should fire at its deadline")
+	}
+	select {
+	case <-late.C():
+		t.Fatal("Later timer should still be pending")
+	default:
+	}
+}
+
+func TestFakeClock_TimerStop(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	timer := clock.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Error("Stop should return true for a pending timer")
+	}
+	if timer.Stop() {
+		t.Error("Stop should return false once stopped")
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case <-timer.C():
+		t.Error("Stopped timer should not fire")
+	default:
+	}
+}
+
+func TestFakeClock_ImmediateTimer(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	timer := clock.NewTimer(0)
+
+	select {
+	case <-timer.C():
+	default:
+		t.Error("Zero duration timer should fire immediately")
+	}
+}
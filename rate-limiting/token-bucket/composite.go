@@ -0,0 +1,155 @@
+package tokenbucket
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Tier is one level of a Composite limiter
+type Tier struct {
+	// Name identifies the tier in CompositeResult.DeniedBy, e.g. "tenant"
+	Name string
+
+	// Limiter enforces this tier's limit and must implement Refunder
+	Limiter Limiter
+
+	// Key maps the request key to this tier's key (nil = use the request key)
+	// e.g. "user:alice" -> "tenant:acme", or a constant for a global limit
+	Key func(key string) string
+}
+
+// FixedKey returns a Tier.Key function that maps every request to key
+// Useful for a global tier shared by all callers
+func FixedKey(key string) func(string) string {
+	return func(string) string {
+		return key
+	}
+}
+
+// Composite evaluates an ordered set of tiers (e.g. per-user, per-tenant,
+// global) all-or-nothing: a request is only allowed if every tier allows it,
+// and if any tier denies, the tokens taken from the other tiers are refunded.
+//
+// Every tier is checked even after a denial so the merged result reports the
+// most restrictive RetryAfter. Composite serializes its own calls, but a
+// caller using a tier limiter directly at the same time may briefly observe
+// tokens that are about to be refunded.
+type Composite struct {
+	mu    sync.Mutex
+	tiers []Tier
+}
+
+// CompositeResult is the merged result of all tiers
+type CompositeResult struct {
+	// Result merges the tiers: Allowed only if all allowed, the smallest
+	// Limit and Remaining, the longest RetryAfter and the latest ResetAt
+	Result
+
+	// DeniedBy names the first tier that denied the request ("" if allowed)
+	DeniedBy string
+
+	// Tiers holds each tier's own result, in tier order
+	Tiers []*Result
+}
+
+// NewComposite creates a composite limiter from tiers, evaluated in order
+// Returns an error if a tier's limiter cannot refund
+func NewComposite(tiers ...Tier) (*Composite, error) {
+	if len(tiers) == 0 {
+		return nil, errors.New("tokenbucket: composite needs at least one tier")
+	}
+	for i, tier := range tiers {
+		if _, ok := tier.Limiter.(Refunder); !ok {
+			return nil, fmt.Errorf("tokenbucket: tier %d (%s) limiter %T does not implement Refunder", i, tier.Name, tier.Limiter)
+		}
+	}
+	return &Composite{tiers: tiers}, nil
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (c *Composite) Allow(key string) bool {
+	return c.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed by every tier
+func (c *Composite) AllowN(key string, n int) bool {
+	return c.AllowWithTiers(key, n).Allowed
+}
+
+// AllowWithInfo returns the merged result of all tiers
+func (c *Composite) AllowWithInfo(key string, n int) *Result {
+	return &c.AllowWithTiers(key, n).Result
+}
+
+// AllowWithTiers checks every tier and reports which one denied, if any
+func (c *Composite) AllowWithTiers(key string, n int) *CompositeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	merged := &CompositeResult{
+		Result: Result{Allowed: true},
+		Tiers:  make([]*Result, len(c.tiers)),
+	}
+	for i, tier := range c.tiers {
+		r := tier.Limiter.AllowWithInfo(tier.key(key), n)
+		merged.Tiers[i] = r
+		if !r.Allowed && merged.Allowed {
+			merged.Allowed = false
+			merged.DeniedBy = tier.Name
+		}
+	}
+
+	if !merged.Allowed {
+		// Undo the tiers that did consume
+		for i, tier := range c.tiers {
+			if r := merged.Tiers[i]; r.Allowed {
+				tier.Limiter.(Refunder).Refund(tier.key(key), n)
+				r.Remaining = min(r.Remaining+n, r.Limit)
+			}
+		}
+	}
+
+	for i, r := range merged.Tiers {
+		if i == 0 || r.Limit < merged.Limit {
+			merged.Limit = r.Limit
+		}
+		if i == 0 || r.Remaining < merged.Remaining {
+			merged.Remaining = r.Remaining
+		}
+		if !r.Allowed && r.RetryAfter > merged.RetryAfter {
+			merged.RetryAfter = r.RetryAfter
+		}
+		if r.ResetAt.After(merged.ResetAt) {
+			merged.ResetAt = r.ResetAt
+		}
+		merged.Debt = max(merged.Debt, r.Debt)
+	}
+	return merged
+}
+
+// Refund returns n units to every tier
+func (c *Composite) Refund(key string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tier := range c.tiers {
+		tier.Limiter.(Refunder).Refund(tier.key(key), n)
+	}
+}
+
+// Reset clears the state of key in every tier
+// Note this also resets shared tiers (e.g. the global one) for everyone
+func (c *Composite) Reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tier := range c.tiers {
+		tier.Limiter.Reset(tier.key(key))
+	}
+}
+
+func (t Tier) key(key string) string {
+	if t.Key == nil {
+		return key
+	}
+	return t.Key(key)
+}
@@ -0,0 +1,146 @@
+package tokenbucket
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Per-user, per-tenant and global tiers on a shared fake clock
+// Keys look like "acme/alice": tenant "acme", user "alice"
+func newTieredLimiter(t *testing.T, clock *FakeClock) (*Composite, *TokenBucket, *TokenBucket, *TokenBucket) {
+	t.Helper()
+	user := NewTokenBucket(5, time.Second, 5, WithClock(clock))
+	tenant := NewTokenBucket(8, time.Second, 8, WithClock(clock))
+	global := NewTokenBucket(20, time.Second, 20, WithClock(clock))
+
+	c, err := NewComposite(
+		Tier{Name: "user", Limiter: user},
+		Tier{Name: "tenant", Limiter: tenant, Key: func(key string) string {
+			tenant, _, _ := strings.Cut(key, "/")
+			return "tenant:" + tenant
+		}},
+		Tier{Name: "global", Limiter: global, Key: FixedKey("global")},
+	)
+	if err != nil {
+		t.Fatalf("NewComposite failed: %v", err)
+	}
+	return c, user, tenant, global
+}
+
+func TestComposite_AllTiersMustAllow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	c, _, _, _ := newTieredLimiter(t, clock)
+
+	// Alice can use her whole user limit
+	for i := 0; i < 5; i++ {
+		if !c.Allow("acme/alice") {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	result := c.AllowWithTiers("acme/alice", 1)
+	if result.Allowed || result.DeniedBy != "user" {
+		t.Errorf("Expected denial by user tier, got allowed=%v deniedBy=%q", result.Allowed, result.DeniedBy)
+	}
+
+	// Bob shares the tenant: only 3 of the tenant's 8 are left
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if c.Allow("acme/bob") {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("Expected tenant tier to cap bob at 3, got %d", allowed)
+	}
+	result = c.AllowWithTiers("acme/bob", 1)
+	if result.DeniedBy != "tenant" {
+		t.Errorf("Expected denial by tenant tier, got %q", result.DeniedBy)
+	}
+}
+
+func TestComposite_NoLeakOnPartialSuccess(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	c, user, tenant, global := newTieredLimiter(t, clock)
+
+	// Drain the tenant tier directly
+	tenant.AllowN("tenant:acme", 8)
+
+	// Denied by the tenant: the user and global tiers must get their tokens back
+	for i := 0; i < 10; i++ {
+		if c.Allow("acme/carol") {
+			t.Fatal("Request should be denied by the tenant tier")
+		}
+	}
+	if r := user.AllowWithInfo("acme/carol", 0); r.Remaining != 5 {
+		t.Errorf("User tier leaked tokens: %d remaining, want 5", r.Remaining)
+	}
+	if r := global.AllowWithInfo("global", 0); r.Remaining != 20 {
+		t.Errorf("Global tier leaked tokens: %d remaining, want 20", r.Remaining)
+	}
+}
+
+func TestComposite_MergedResult(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	c, user, tenant, _ := newTieredLimiter(t, clock)
+
+	user.AllowN("acme/dave", 5)     // Needs 200ms for 1 token
+	tenant.AllowN("tenant:acme", 8) // Needs 125ms for 1 token
+
+	result := c.AllowWithTiers("acme/dave", 1)
+	if result.Allowed {
+		t.Fatal("Request should be denied")
+	}
+	if result.DeniedBy != "user" {
+		t.Errorf("First denying tier should be reported, got %q", result.DeniedBy)
+	}
+	// Most restrictive tier decides
+	if result.RetryAfter != 200*time.Millisecond {
+		t.Errorf("Expected the longest RetryAfter (200ms), got %v", result.RetryAfter)
+	}
+	if result.Remaining != 0 || result.Limit != 5 {
+		t.Errorf("Expected remaining 0 and limit 5, got %d/%d", result.Remaining, result.Limit)
+	}
+	if len(result.Tiers) != 3 || !result.Tiers[2].Allowed || result.Tiers[2].Remaining != 20 {
+		t.Errorf("Global tier result should show its refunded capacity, got %+v", result.Tiers[2])
+	}
+
+	clock.Advance(200 * time.Millisecond)
+	if !c.Allow("acme/dave") {
+		t.Error("Request should be allowed after RetryAfter")
+	}
+}
+
+func TestComposite_WorksWithAnyAlgorithm(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	c, err := NewComposite(
+		Tier{Name: "burst", Limiter: NewGCRA(5, time.Second, 5, WithClock(clock))},
+		Tier{Name: "minute", Limiter: NewSlidingWindowLog(6, time.Minute, WithClock(clock))},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.AllowN("k", 5)
+	clock.Advance(time.Second)
+	if !c.Allow("k") {
+		t.Error("Sixth request in the minute should be allowed")
+	}
+	result := c.AllowWithTiers("k", 1)
+	if result.DeniedBy != "minute" {
+		t.Errorf("Expected denial by the minute tier, got %q", result.DeniedBy)
+	}
+}
+
+// Limiter without Refund
+type plainLimiter struct{ Limiter }
+
+func TestNewComposite_RequiresRefunder(t *testing.T) {
+	if _, err := NewComposite(); err == nil {
+		t.Error("Composite without tiers should be rejected")
+	}
+	_, err := NewComposite(Tier{Name: "plain", Limiter: plainLimiter{NewTokenBucket(1, time.Second, 1)}})
+	if err == nil {
+		t.Error("Tier limiter without Refund should be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+package tokenbucket
+
+import (
+	"container/list"
+	"time"
+)
+
+// Stats describes how many keys a TokenBucket is tracking
+type Stats struct {
+	// Keys is the number of buckets currently held in memory
+	Keys int
+
+	// Evicted is the total number of buckets removed by the idle janitor or the key cap
+	Evicted uint64
+}
+
+// Stats returns counts of live and evicted keys
+func (tb *TokenBucket) Stats() Stats {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return Stats{
+		Keys:    len(tb.buckets),
+		Evicted: tb.evicted,
+	}
+}
+
+// Close stops the background janitor and snapshotter, if any
+// With WithSnapshotFile a final snapshot is written and its error returned.
+// The limiter keeps working after Close, it just stops background work.
+func (tb *TokenBucket) Close() error {
+	var err error
+	tb.closeOnce.Do(func() {
+		if tb.stop != nil {
+			close(tb.stop)
+		}
+		tb.background.Wait()
+		if tb.snapshotPath != "" {
+			err = tb.SnapshotFile(tb.snapshotPath)
+		}
+	})
+	return err
+}
+
+// Store a new bucket, evicting the least recently used key if over the cap
+// Caller must hold tb.mu
+func (tb *TokenBucket) insert(key string, b *bucket) {
+	tb.buckets[key] = b
+	if tb.lru == nil {
+		return
+	}
+	b.elem = tb.lru.PushFront(key)
+	for len(tb.buckets) > tb.maxKeys {
+		oldest := tb.lru.Back()
+		tb.remove(oldest.Value.(string))
+		tb.evicted++
+	}
+}
+
+// Mark an existing bucket as most recently used
+// Caller must hold tb.mu
+func (tb *TokenBucket) touch(b *bucket) {
+	if tb.lru != nil {
+		tb.lru.MoveToFront(b.elem)
+	}
+}
+
+// Delete a bucket and its LRU entry
+// Caller must hold tb.mu
+func (tb *TokenBucket) remove(key string) {
+	b, exists := tb.buckets[key]
+	if !exists {
+		return
+	}
+	if tb.lru != nil {
+		tb.lru.Remove(b.elem)
+	}
+	delete(tb.buckets, key)
+}
+
+// Run sweep every interval until Close is called
+func (tb *TokenBucket) janitor(interval time.Duration) {
+	defer tb.background.Done()
+	for {
+		timer := tb.clock.NewTimer(interval)
+		select {
+		case <-timer.C():
+			tb.sweep(tb.clock.Now())
+		case <-tb.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Remove buckets that are full and have been idle for longer than the TTL
+// Returns the number of buckets evicted
+func (tb *TokenBucket) sweep(now time.Time) int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	evicted := 0
+	for key, b := range tb.buckets {
+		idle := now.Sub(b.lastRefill)
+		if idle < tb.idleTTL {
+			continue
+		}
+		// Only forget buckets that would have refilled completely by now,
+		// otherwise a throttled client could get a fresh burst by going quiet
+		p := tb.policyFor(key)
+		if b.tokens+p.refillRate()*idle.Seconds() < float64(p.BurstSize) {
+			continue
+		}
+		tb.remove(key)
+		evicted++
+	}
+	tb.evicted += uint64(evicted)
+	return evicted
+}
+
+// Set up LRU tracking and the janitor based on options
+func (tb *TokenBucket) startEviction(o options) {
+	if o.maxKeys > 0 {
+		tb.maxKeys = o.maxKeys
+		tb.lru = list.New()
+	}
+	if o.idleTTL > 0 {
+		tb.idleTTL = o.idleTTL
+		tb.stop = make(chan struct{})
+		tb.background.Add(1)
+		go tb.janitor(o.sweepInterval)
+	}
+}
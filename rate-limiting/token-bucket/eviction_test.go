@@ -0,0 +1,136 @@
+package tokenbucket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_SweepEvictsIdleFullBuckets(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock), WithIdleTTL(time.Minute))
+	defer limiter.Close()
+
+	limiter.Allow("user:alice")
+	limiter.Allow("user:bob")
+
+	// Not idle long enough yet
+	if n := limiter.sweep(epoch.Add(59 * time.Second)); n != 0 {
+		t.Errorf("Expected no evictions before the TTL, got %d", n)
+	}
+
+	if n := limiter.sweep(epoch.Add(time.Minute)); n != 2 {
+		t.Errorf("Expected 2 evictions after the TTL, got %d", n)
+	}
+	stats := limiter.Stats()
+	if stats.Keys != 0 || stats.Evicted != 2 {
+		t.Errorf("Expected 0 keys and 2 evicted, got %+v", stats)
+	}
+}
+
+func TestTokenBucket_SweepKeepsThrottledBuckets(t *testing.T) {
+	// 10 tokens per day: a drained bucket stays below full for hours
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, 24*time.Hour, 10, WithClock(clock), WithIdleTTL(time.Minute))
+	defer limiter.Close()
+	key := "user:charlie"
+
+	limiter.AllowN(key, 10)
+	if n := limiter.sweep(epoch.Add(time.Hour)); n != 0 {
+		t.Errorf("Throttled bucket should not be evicted, got %d evictions", n)
+	}
+	if limiter.Allow(key) {
+		t.Error("Key should still be throttled after the sweep")
+	}
+}
+
+func TestTokenBucket_JanitorRuns(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(1000, time.Second, 10, WithClock(clock),
+		WithIdleTTL(time.Minute), WithSweepInterval(10*time.Second))
+	defer limiter.Close()
+
+	limiter.Allow("user:david")
+
+	// Let the janitor run every 10s until it has swept past the TTL
+	for i := 0; i < 6; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(10 * time.Second)
+	}
+	clock.BlockUntil(1) // Janitor is waiting again, so the last sweep finished
+
+	if stats := limiter.Stats(); stats.Keys != 0 || stats.Evicted != 1 {
+		t.Errorf("Janitor should have evicted the idle key, got %+v", stats)
+	}
+}
+
+func TestTokenBucket_Close(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithIdleTTL(time.Minute))
+
+	if err := limiter.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	// Closing twice is safe and the limiter still works
+	limiter.Close()
+	if !limiter.Allow("user:eve") {
+		t.Error("Limiter should keep working after Close")
+	}
+
+	// Close without a janitor is a no-op
+	NewTokenBucket(10, time.Second, 10).Close()
+
+	// Close returns only once the janitor has stopped
+	clock := NewFakeClock(epoch)
+	limiter = NewTokenBucket(10, time.Second, 10, WithClock(clock), WithIdleTTL(time.Minute))
+	clock.BlockUntil(1)
+	limiter.Close()
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	if len(clock.timers) != 0 {
+		t.Error("Janitor should have stopped its timer before Close returned")
+	}
+}
+
+func TestTokenBucket_MaxKeysEvictsLRU(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithMaxKeys(3))
+
+	limiter.Allow("a")
+	limiter.Allow("b")
+	limiter.Allow("c")
+	limiter.Allow("a") // a is now most recently used
+	limiter.Allow("d") // evicts b
+
+	stats := limiter.Stats()
+	if stats.Keys != 3 || stats.Evicted != 1 {
+		t.Fatalf("Expected 3 keys and 1 evicted, got %+v", stats)
+	}
+	if _, exists := limiter.buckets["b"]; exists {
+		t.Error("Least recently used key should have been evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, exists := limiter.buckets[key]; !exists {
+			t.Errorf("Key %s should still be tracked", key)
+		}
+	}
+}
+
+func TestTokenBucket_MaxKeysBoundsMemory(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithMaxKeys(100))
+
+	for i := 0; i < 10000; i++ {
+		limiter.Allow(fmt.Sprintf("ip:%d", i))
+	}
+
+	stats := limiter.Stats()
+	if stats.Keys != 100 || stats.Evicted != 9900 {
+		t.Errorf("Expected 100 keys and 9900 evicted, got %+v", stats)
+	}
+	if limiter.lru.Len() != len(limiter.buckets) {
+		t.Errorf("LRU list out of sync: %d entries for %d buckets", limiter.lru.Len(), len(limiter.buckets))
+	}
+
+	limiter.Reset("ip:9999")
+	if limiter.lru.Len() != 99 {
+		t.Errorf("Reset should remove the LRU entry, got %d entries", limiter.lru.Len())
+	}
+}
@@ -0,0 +1,307 @@
+package tokenbucket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DropPolicy decides which request a full FairQueue gives up on
+type DropPolicy int
+
+const (
+	// DropNewest rejects the arriving request
+	DropNewest DropPolicy = iota
+
+	// DropOldest evicts the request that has waited longest
+	DropOldest
+)
+
+var (
+	// ErrQueueFull is returned when a request is rejected by a full queue
+	ErrQueueFull = errors.New("tokenbucket: queue full")
+
+	// ErrDropped is returned to a queued request evicted by DropOldest
+	ErrDropped = errors.New("tokenbucket: request dropped from queue")
+)
+
+// Request describes a caller waiting in a FairQueue
+type Request struct {
+	// Priority classes are served strictly in order, 0 first
+	Priority int
+
+	// Flow groups requests sharing a fair share within a priority,
+	// e.g. a peer ID or message type
+	Flow string
+
+	// Weight is the flow's share relative to other flows in its priority (default 1)
+	Weight float64
+
+	// N is the number of tokens needed (default 1)
+	N int
+
+	// Deadline drops the request if it hasn't been granted by then,
+	// measured on the bucket's clock (zero = none)
+	Deadline time.Time
+}
+
+// FairQueue grants a TokenBucket's tokens to queued callers in order instead
+// of letting them race. Requests are served by strict priority across
+// classes and by weighted fair queueing within a class: each flow's requests
+// get virtual finish times advancing by N/Weight, and the smallest finish
+// time goes next, so a flow with weight 2 gets twice the tokens of a flow
+// with weight 1 when both are backlogged.
+//
+// Queues are per key and bounded. When a key's queue is full, the policy
+// picks a victim among the lowest priority class present: the arriving
+// request (DropNewest) or the longest waiting one (DropOldest). A request of
+// higher priority than everything queued always displaces a lower one.
+type FairQueue struct {
+	tb       *TokenBucket
+	maxQueue int
+	policy   DropPolicy
+
+	mu     sync.Mutex
+	queues map[string]*keyQueue
+}
+
+type keyQueue struct {
+	waiters []*waiter
+	seq     uint64             // Arrival counter, orders DropOldest
+	vtime   map[int]float64    // Per priority: finish time of the last granted request
+	flows   map[flowID]float64 // Finish time of each flow's last queued request
+	retry   chan struct{}      // Closed to cancel the pending retry timer (nil = none)
+}
+
+type flowID struct {
+	priority int
+	flow     string
+}
+
+type waiter struct {
+	req     Request
+	seq     uint64
+	finish  float64
+	granted chan error // Buffered, receives exactly one result
+}
+
+// NewFairQueue creates a queue over tb holding at most maxQueue waiting
+// requests per key
+func NewFairQueue(tb *TokenBucket, maxQueue int, policy DropPolicy) *FairQueue {
+	return &FairQueue{
+		tb:       tb,
+		maxQueue: maxQueue,
+		policy:   policy,
+		queues:   make(map[string]*keyQueue),
+	}
+}
+
+// Wait blocks until req's tokens for key are granted, ctx is done, the
+// request's deadline passes or it is dropped from a full queue
+func (q *FairQueue) Wait(ctx context.Context, key string, req Request) error {
+	if req.N <= 0 {
+		req.N = 1
+	}
+	if req.Weight <= 0 {
+		req.Weight = 1
+	}
+	if req.N > q.tb.PolicyFor(key).BurstSize {
+		return ErrExceedsBurst
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	w, err := q.enqueue(key, req)
+	if w == nil || err != nil {
+		return err
+	}
+
+	select {
+	case err := <-w.granted:
+		return err
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if kq := q.queues[key]; kq != nil && kq.remove(w) {
+			q.dispatch(key, kq)
+			return ctx.Err()
+		}
+		// Granted or dropped while we were giving up
+		if err := <-w.granted; err != nil {
+			return err
+		}
+		q.tb.Refund(key, req.N)
+		return ctx.Err()
+	}
+}
+
+// Len returns how many requests are waiting for key
+func (q *FairQueue) Len(key string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if kq := q.queues[key]; kq != nil {
+		return len(kq.waiters)
+	}
+	return 0
+}
+
+// Add a waiter for key, returns a nil waiter if granted right away
+func (q *FairQueue) enqueue(key string, req Request) (*waiter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kq := q.queues[key]
+	if kq == nil {
+		// Nobody waiting: take the tokens directly if there are enough
+		if q.tb.AllowN(key, req.N) {
+			return nil, nil
+		}
+		kq = &keyQueue{
+			vtime: make(map[int]float64),
+			flows: make(map[flowID]float64),
+		}
+		q.queues[key] = kq
+	}
+
+	if len(kq.waiters) >= q.maxQueue {
+		victim := kq.victim(q.policy)
+		if victim == nil || victim.req.Priority < req.Priority ||
+			(q.policy == DropNewest && victim.req.Priority == req.Priority) {
+			if len(kq.waiters) == 0 {
+				delete(q.queues, key)
+			}
+			return nil, ErrQueueFull
+		}
+		kq.remove(victim)
+		victim.granted <- ErrDropped
+	}
+
+	kq.seq++
+	id := flowID{req.Priority, req.Flow}
+	start := max(kq.vtime[req.Priority], kq.flows[id])
+	w := &waiter{
+		req:     req,
+		seq:     kq.seq,
+		finish:  start + float64(req.N)/req.Weight,
+		granted: make(chan error, 1),
+	}
+	kq.flows[id] = w.finish
+	kq.waiters = append(kq.waiters, w)
+	q.dispatch(key, kq)
+	return w, nil
+}
+
+// Grant tokens to as many waiters as possible, in order, then schedule a
+// retry for when the next one can be served
+// Caller must hold q.mu
+func (q *FairQueue) dispatch(key string, kq *keyQueue) {
+	if kq.retry != nil {
+		close(kq.retry)
+		kq.retry = nil
+	}
+
+	now := q.tb.clock.Now()
+	var wake time.Duration
+	for len(kq.waiters) > 0 {
+		kq.expire(now)
+		next := kq.next()
+		if next == nil {
+			break
+		}
+		result := q.tb.AllowWithInfo(key, next.req.N)
+		if !result.Allowed {
+			wake = result.RetryAfter
+			break
+		}
+		kq.remove(next)
+		kq.vtime[next.req.Priority] = next.finish
+		next.granted <- nil
+	}
+
+	if len(kq.waiters) == 0 {
+		delete(q.queues, key)
+		return
+	}
+	// Wake up early for a deadline that passes before the tokens arrive
+	for _, w := range kq.waiters {
+		if !w.req.Deadline.IsZero() {
+			wake = min(wake, max(w.req.Deadline.Sub(now), 0))
+		}
+	}
+
+	stop := make(chan struct{})
+	kq.retry = stop
+	timer := q.tb.clock.NewTimer(max(wake, time.Nanosecond))
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+		case <-stop:
+			return
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if kq.retry == stop {
+			kq.retry = nil
+			q.dispatch(key, kq)
+		}
+	}()
+}
+
+// Highest priority waiter with the smallest finish time
+func (kq *keyQueue) next() *waiter {
+	var best *waiter
+	for _, w := range kq.waiters {
+		if best == nil || w.req.Priority < best.req.Priority ||
+			(w.req.Priority == best.req.Priority && w.finish < best.finish) ||
+			(w.req.Priority == best.req.Priority && w.finish == best.finish && w.seq < best.seq) {
+			best = w
+		}
+	}
+	return best
+}
+
+// Waiter to drop from a full queue: the oldest or newest of the lowest priority
+func (kq *keyQueue) victim(policy DropPolicy) *waiter {
+	var victim *waiter
+	for _, w := range kq.waiters {
+		switch {
+		case victim == nil || w.req.Priority > victim.req.Priority:
+			victim = w
+		case w.req.Priority < victim.req.Priority:
+		case policy == DropOldest && w.seq < victim.seq:
+			victim = w
+		case policy == DropNewest && w.seq > victim.seq:
+			victim = w
+		}
+	}
+	return victim
+}
+
+// Fail waiters whose deadline has passed
+func (kq *keyQueue) expire(now time.Time) {
+	for _, w := range append([]*waiter(nil), kq.waiters...) {
+		if !w.req.Deadline.IsZero() && !now.Before(w.req.Deadline) {
+			kq.remove(w)
+			w.granted <- context.DeadlineExceeded
+		}
+	}
+}
+
+// Remove w from the queue, returns false if it wasn't queued
+func (kq *keyQueue) remove(w *waiter) bool {
+	for i, queued := range kq.waiters {
+		if queued == w {
+			kq.waiters = append(kq.waiters[:i], kq.waiters[i+1:]...)
+			if len(kq.waiters) == 0 {
+				// Idle: fair share restarts from zero
+				clear(kq.vtime)
+				clear(kq.flows)
+			}
+			return true
+		}
+	}
+	return false
+}
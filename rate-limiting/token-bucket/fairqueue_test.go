@@ -0,0 +1,220 @@
+package tokenbucket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Start Wait in a goroutine and return once the request is queued
+func enqueue(t *testing.T, q *FairQueue, key string, req Request) <-chan error {
+	t.Helper()
+	before := arrivals(q, key)
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Wait(context.Background(), key, req)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for arrivals(q, key) == before {
+		select {
+		case err := <-done:
+			// Finished without queueing (rejected or granted)
+			done <- err
+			return done
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for request to queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return done
+}
+
+// Requests queued for key so far, including ones since dropped
+func arrivals(q *FairQueue, key string) uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if kq := q.queues[key]; kq != nil {
+		return kq.seq
+	}
+	return 0
+}
+
+func result(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for queued request")
+		return nil
+	}
+}
+
+// One token per second, burst 1, already spent
+func emptyBucket() (*TokenBucket, *FakeClock) {
+	clock := NewFakeClock(epoch)
+	tb := NewTokenBucket(1, time.Second, 1, WithClock(clock))
+	tb.Allow("peer")
+	return tb, clock
+}
+
+func TestFairQueue_GrantsImmediately(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10, WithClock(NewFakeClock(epoch)))
+	q := NewFairQueue(tb, 10, DropNewest)
+	if err := q.Wait(context.Background(), "peer", Request{N: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Wait(context.Background(), "peer", Request{N: 11}); !errors.Is(err, ErrExceedsBurst) {
+		t.Errorf("Expected ErrExceedsBurst, got %v", err)
+	}
+}
+
+func TestFairQueue_StrictPriority(t *testing.T) {
+	tb, clock := emptyBucket()
+	q := NewFairQueue(tb, 10, DropNewest)
+
+	gossip := enqueue(t, q, "peer", Request{Priority: 1})
+	consensus := enqueue(t, q, "peer", Request{Priority: 0})
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if err := result(t, consensus); err != nil {
+		t.Fatalf("Consensus should be served first, got %v", err)
+	}
+	select {
+	case <-gossip:
+		t.Fatal("Gossip should still be waiting")
+	default:
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if err := result(t, gossip); err != nil {
+		t.Errorf("Gossip should be served next, got %v", err)
+	}
+	if n := q.Len("peer"); n != 0 {
+		t.Errorf("Expected empty queue, got %d", n)
+	}
+}
+
+func TestFairQueue_WeightedFairShare(t *testing.T) {
+	tb, clock := emptyBucket()
+	q := NewFairQueue(tb, 100, DropNewest)
+
+	granted := make(chan string, 12)
+	for i := 0; i < 6; i++ {
+		for _, flow := range []struct {
+			name   string
+			weight float64
+		}{{"a", 2}, {"b", 1}} {
+			done := enqueue(t, q, "peer", Request{Flow: flow.name, Weight: flow.weight})
+			go func(name string) {
+				if <-done == nil {
+					granted <- name
+				}
+			}(flow.name)
+		}
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 6; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		select {
+		case flow := <-granted:
+			counts[flow]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for grant")
+		}
+	}
+	if counts["a"] != 4 || counts["b"] != 2 {
+		t.Errorf("Expected 2:1 share (4 a, 2 b), got %v", counts)
+	}
+}
+
+func TestFairQueue_DropNewest(t *testing.T) {
+	tb, _ := emptyBucket()
+	q := NewFairQueue(tb, 2, DropNewest)
+
+	first := enqueue(t, q, "peer", Request{Priority: 1})
+	second := enqueue(t, q, "peer", Request{Priority: 1})
+	if err := result(t, enqueue(t, q, "peer", Request{Priority: 1})); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for newest, got %v", err)
+	}
+
+	// Higher priority displaces the newest low priority request
+	enqueue(t, q, "peer", Request{Priority: 0})
+	if err := result(t, second); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected newest low priority request dropped, got %v", err)
+	}
+	select {
+	case err := <-first:
+		t.Errorf("Oldest request should still wait, got %v", err)
+	default:
+	}
+}
+
+func TestFairQueue_DropOldest(t *testing.T) {
+	tb, _ := emptyBucket()
+	q := NewFairQueue(tb, 2, DropOldest)
+
+	first := enqueue(t, q, "peer", Request{Priority: 1})
+	enqueue(t, q, "peer", Request{Priority: 1})
+	enqueue(t, q, "peer", Request{Priority: 1})
+	if err := result(t, first); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected oldest request dropped, got %v", err)
+	}
+	if n := q.Len("peer"); n != 2 {
+		t.Errorf("Expected 2 queued, got %d", n)
+	}
+
+	// Lower priority than everything queued is rejected outright
+	if err := result(t, enqueue(t, q, "peer", Request{Priority: 2})); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for lowest priority, got %v", err)
+	}
+}
+
+func TestFairQueue_Deadline(t *testing.T) {
+	tb, clock := emptyBucket()
+	q := NewFairQueue(tb, 10, DropNewest)
+
+	done := enqueue(t, q, "peer", Request{Deadline: epoch.Add(500 * time.Millisecond)})
+	clock.BlockUntil(1)
+	clock.Advance(500 * time.Millisecond)
+	if err := result(t, done); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if !tb.Allow("peer") {
+		t.Error("Expired request should not consume tokens")
+	}
+}
+
+func TestFairQueue_ContextCancel(t *testing.T) {
+	tb, clock := emptyBucket()
+	q := NewFairQueue(tb, 10, DropNewest)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Wait(ctx, "peer", Request{})
+	}()
+	for q.Len("peer") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := result(t, done); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if n := q.Len("peer"); n != 0 {
+		t.Errorf("Cancelled request should leave the queue, got %d", n)
+	}
+
+	clock.Advance(time.Second)
+	if !tb.Allow("peer") {
+		t.Error("Cancelled request should not consume tokens")
+	}
+}
@@ -0,0 +1,101 @@
+package tokenbucket
+
+import (
+	"sync"
+	"time"
+)
+
+// FixedWindow implements the fixed window counter algorithm
+// Each key may make up to limit requests per window. The counter resets
+// to zero when the window ends.
+//
+// Windows are anchored at the first request for a key rather than at
+// wall clock boundaries, so different keys do not all reset at once.
+// Trade-off: a client can send up to 2x limit across a window boundary.
+type FixedWindow struct {
+	mu      sync.Mutex
+	windows map[string]*fixedWindow
+	limit   int           // Max requests per window
+	window  time.Duration // Length of each window
+	clock   Clock
+}
+
+type fixedWindow struct {
+	start time.Time
+	count int
+}
+
+// NewFixedWindow creates a fixed window rate limiter allowing limit requests per window
+func NewFixedWindow(limit int, window time.Duration, opts ...Option) *FixedWindow {
+	return &FixedWindow{
+		windows: make(map[string]*fixedWindow),
+		limit:   limit,
+		window:  window,
+		clock:   buildOptions(opts).clock,
+	}
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (fw *FixedWindow) Allow(key string) bool {
+	return fw.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (fw *FixedWindow) AllowN(key string, n int) bool {
+	return fw.AllowWithInfo(key, n).Allowed
+}
+
+// Reset clears the rate limit state for a key
+func (fw *FixedWindow) Reset(key string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	delete(fw.windows, key)
+}
+
+// Refund removes n requests from the current window's count
+func (fw *FixedWindow) Refund(key string, n int) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	w, exists := fw.windows[key]
+	if !exists || fw.clock.Now().Sub(w.start) >= fw.window {
+		// Window already ended, the requests no longer count
+		return
+	}
+	w.count = max(w.count-n, 0)
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+func (fw *FixedWindow) AllowWithInfo(key string, n int) *Result {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := fw.clock.Now()
+	w, exists := fw.windows[key]
+	if !exists {
+		w = &fixedWindow{start: now}
+		fw.windows[key] = w
+	} else if elapsed := now.Sub(w.start); elapsed >= fw.window {
+		// Jump forward by whole windows so the anchor stays stable
+		w.start = w.start.Add(elapsed - elapsed%fw.window)
+		w.count = 0
+	}
+
+	allowed := w.count+n <= fw.limit
+	if allowed {
+		w.count += n
+	}
+
+	windowEnd := w.start.Add(fw.window)
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     fw.limit,
+		Remaining: fw.limit - w.count,
+		ResetAt:   windowEnd,
+	}
+	if !allowed {
+		// Nothing frees up until the window ends
+		result.RetryAfter = windowEnd.Sub(now)
+	}
+	return result
+}
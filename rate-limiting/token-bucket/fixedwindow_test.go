@@ -0,0 +1,66 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedWindow_ResetsAfterWindow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewFixedWindow(5, 100*time.Millisecond, WithClock(clock))
+	key := "user:alice"
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow(key)
+	}
+	clock.Advance(40 * time.Millisecond)
+	result := limiter.AllowWithInfo(key, 1)
+	if result.Allowed {
+		t.Fatal("Should be denied after using the whole window")
+	}
+	if result.RetryAfter != 60*time.Millisecond {
+		t.Errorf("RetryAfter should be the rest of the window, got %v", result.RetryAfter)
+	}
+
+	// Whole quota comes back at once when the window ends
+	clock.Advance(60 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(key) {
+			t.Errorf("Request %d should be allowed in the new window", i+1)
+		}
+	}
+}
+
+func TestFixedWindow_NoPartialRefill(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewFixedWindow(10, 200*time.Millisecond, WithClock(clock))
+	key := "user:bob"
+
+	for i := 0; i < 10; i++ {
+		limiter.Allow(key)
+	}
+
+	// Halfway through the window nothing has been freed
+	clock.Advance(100 * time.Millisecond)
+	if limiter.Allow(key) {
+		t.Error("Fixed window should not refill before the window ends")
+	}
+}
+
+func TestFixedWindow_AnchorSkipsIdleWindows(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewFixedWindow(5, time.Second, WithClock(clock))
+	key := "user:charlie"
+
+	limiter.Allow(key)
+
+	// 3.5 windows later we are half way through the 4th window after the anchor
+	clock.Advance(3500 * time.Millisecond)
+	result := limiter.AllowWithInfo(key, 1)
+	if want := epoch.Add(4 * time.Second); !result.ResetAt.Equal(want) {
+		t.Errorf("Expected window to end at %v, got %v", want, result.ResetAt)
+	}
+	if result.Remaining != 4 {
+		t.Errorf("Expected a fresh window with 4 remaining, got %d", result.Remaining)
+	}
+}
@@ -0,0 +1,120 @@
+package tokenbucket
+
+import (
+	"sync"
+	"time"
+)
+
+// GCRA implements the generic cell rate algorithm
+// https://en.wikipedia.org/wiki/Generic_cell_rate_algorithm
+//
+// Behaves like TokenBucket with the same rate, window and burst, but instead
+// of a token count and refill time each key stores a single timestamp: the
+// theoretical arrival time (TAT) of the next request if traffic arrived
+// exactly at the sustained rate.
+//
+//	emission interval T = window / rate     (time to earn one token)
+//	burst tolerance  τ = T * burstSize      (how far TAT may run ahead of now)
+//
+// A request of cost n is allowed if TAT + n*T - τ <= now. All math is done in
+// integer nanoseconds so there is no floating point drift, and each key costs
+// one int64 instead of a bucket struct. The price is that T is rounded down to
+// whole nanoseconds (at least 1ns): the burst is exact, but the sustained rate
+// can be slightly above TokenBucket's when window/rate is not a whole number
+// of nanoseconds, and is capped at one token per nanosecond.
+type GCRA struct {
+	mu        sync.Mutex
+	tats      map[string]int64 // Key -> theoretical arrival time in Unix nanoseconds
+	emission  int64            // Nanoseconds per token (T)
+	burstSize int              // Max tokens in bucket
+	clock     Clock
+}
+
+// NewGCRA creates a GCRA rate limiter with the same parameters as NewTokenBucket
+// Note the emission interval is window/rate truncated to whole nanoseconds,
+// and never below 1ns. A rate below 1 is treated as 1 per window.
+func NewGCRA(rate int, window time.Duration, burstSize int, opts ...Option) *GCRA {
+	// Default burst size to rate if not specified
+	if burstSize == 0 {
+		burstSize = rate
+	}
+	rate = max(rate, 1)
+	return &GCRA{
+		tats:      make(map[string]int64),
+		emission:  max(int64(window)/int64(rate), 1),
+		burstSize: burstSize,
+		clock:     buildOptions(opts).clock,
+	}
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (g *GCRA) Allow(key string) bool {
+	return g.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (g *GCRA) AllowN(key string, n int) bool {
+	return g.AllowWithInfo(key, n).Allowed
+}
+
+// Reset clears the rate limit state for a key
+func (g *GCRA) Reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.tats, key)
+}
+
+// Refund returns n tokens by moving the theoretical arrival time back
+func (g *GCRA) Refund(key string, n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tat, exists := g.tats[key]
+	if !exists {
+		return
+	}
+	tat -= int64(n) * g.emission
+	if tat <= g.clock.Now().UnixNano() {
+		// Bucket is full again, same as having no state
+		delete(g.tats, key)
+		return
+	}
+	g.tats[key] = tat
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+func (g *GCRA) AllowWithInfo(key string, n int) *Result {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.clock.Now().UnixNano()
+	tolerance := g.emission * int64(g.burstSize)
+
+	// A TAT in the past means the bucket is full: start from now
+	tat, exists := g.tats[key]
+	if !exists || tat < now {
+		tat = now
+	}
+
+	newTat := tat + int64(n)*g.emission
+	allowAt := newTat - tolerance
+
+	allowed := n <= g.burstSize && allowAt <= now
+	if allowed {
+		tat = newTat
+		g.tats[key] = tat
+	}
+
+	result := &Result{
+		Allowed: allowed,
+		Limit:   g.burstSize,
+		// Tokens available = unused tolerance / T
+		Remaining: int((tolerance - (tat - now)) / g.emission),
+		// Bucket is full again when TAT catches up with real time
+		ResetAt: time.Unix(0, tat),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(allowAt - now)
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCRA_Refill(t *testing.T) {
+	// 10 tokens/second, one token every 100ms
+	clock := NewFakeClock(epoch)
+	limiter := NewGCRA(10, time.Second, 10, WithClock(clock))
+	key := "user:alice"
+
+	for i := 0; i < 10; i++ {
+		limiter.Allow(key)
+	}
+	if limiter.Allow(key) {
+		t.Error("Should be denied after draining bucket")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow(key) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("Expected 5 tokens after 500ms, got %d", allowed)
+	}
+}
+
+func TestGCRA_MatchesTokenBucket(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	gcra := NewGCRA(10, time.Second, 15, WithClock(clock))
+	tb := NewTokenBucket(10, time.Second, 15, WithClock(clock))
+	key := "user:bob"
+
+	// Same sequence of costs and gaps should produce identical results
+	steps := []struct {
+		n   int
+		gap time.Duration
+	}{{1, 0}, {5, 0}, {3, 50 * time.Millisecond}, {6, 0}, {1, 0}, {4, 200 * time.Millisecond}, {3, 0}}
+	for i, step := range steps {
+		clock.Advance(step.gap)
+		g := gcra.AllowWithInfo(key, step.n)
+		b := tb.AllowWithInfo(key, step.n)
+		if g.Allowed != b.Allowed || g.Remaining != b.Remaining {
+			t.Errorf("Request %d (n=%d): GCRA %v/%d, TokenBucket %v/%d",
+				i+1, step.n, g.Allowed, g.Remaining, b.Allowed, b.Remaining)
+		}
+		if g.RetryAfter != b.RetryAfter || !g.ResetAt.Equal(b.ResetAt) {
+			t.Errorf("Request %d: GCRA retry %v reset %v, TokenBucket retry %v reset %v",
+				i+1, g.RetryAfter, g.ResetAt, b.RetryAfter, b.ResetAt)
+		}
+	}
+}
+
+func TestGCRA_ExactRetryAfter(t *testing.T) {
+	// 4 per second -> exactly 250ms per token
+	clock := NewFakeClock(epoch)
+	limiter := NewGCRA(4, time.Second, 2, WithClock(clock))
+	key := "user:charlie"
+
+	limiter.AllowN(key, 2)
+	result := limiter.AllowWithInfo(key, 2)
+	if result.Allowed {
+		t.Fatal("Should be denied with an empty bucket")
+	}
+	// Two tokens need exactly 500ms
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected RetryAfter 500ms, got %v", result.RetryAfter)
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected 0 remaining, got %d", result.Remaining)
+	}
+}
+
+func TestGCRA_OneTimestampPerKey(t *testing.T) {
+	limiter := NewGCRA(10, time.Second, 10)
+
+	for i := 0; i < 1000; i++ {
+		limiter.Allow(string(rune('a' + i%26)))
+	}
+	if len(limiter.tats) != 26 {
+		t.Errorf("Expected one entry per key, got %d", len(limiter.tats))
+	}
+
+	// Denied requests must not create state
+	limiter.AllowN("user:greedy", 11)
+	if _, exists := limiter.tats["user:greedy"]; exists {
+		t.Error("Denied request should not store a TAT")
+	}
+}
+
+func BenchmarkGCRA_Allow(b *testing.B) {
+	limiter := NewGCRA(1000000, time.Second, 1000000)
+	key := "bench:user:1"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		limiter.Allow(key)
+	}
+}
+
+func TestGCRA_EmissionClamped(t *testing.T) {
+	// 2 tokens per nanosecond truncates to 0ns per token, clamped to 1ns
+	clock := NewFakeClock(epoch)
+	limiter := NewGCRA(2e9, time.Second, 10, WithClock(clock))
+	key := "user:fast"
+
+	if !limiter.AllowN(key, 10) {
+		t.Fatal("Full burst should be allowed")
+	}
+	result := limiter.AllowWithInfo(key, 1)
+	if result.Allowed || result.RetryAfter != time.Nanosecond {
+		t.Errorf("Expected denial for 1ns, got %v/%v", result.Allowed, result.RetryAfter)
+	}
+	clock.Advance(time.Nanosecond)
+	if !limiter.Allow(key) {
+		t.Error("One token should refill per nanosecond")
+	}
+}
+
+func TestGCRA_ZeroRate(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewGCRA(0, time.Second, 5, WithClock(clock))
+	key := "user:slow"
+
+	if !limiter.AllowN(key, 5) || limiter.Allow(key) {
+		t.Fatal("Expected exactly the burst to be allowed")
+	}
+	clock.Advance(time.Second)
+	if !limiter.Allow(key) {
+		t.Error("Rate 0 should refill like 1 per window")
+	}
+}
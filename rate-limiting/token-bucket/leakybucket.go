@@ -0,0 +1,110 @@
+package tokenbucket
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LeakyBucket implements the leaky bucket algorithm (as a meter)
+// Each request pours n units of water into the bucket and the bucket
+// leaks at a constant rate. A request is rejected if it would overflow.
+//
+// This is the mirror image of the token bucket: water level = capacity - tokens.
+// The difference shows up in how it is usually configured: capacity is kept
+// small so output is smoothed to the leak rate instead of allowing big bursts.
+type LeakyBucket struct {
+	mu       sync.Mutex
+	buckets  map[string]*leakyBucket
+	rate     int           // Units leaked per window
+	window   time.Duration // Time window for rate
+	capacity int           // Max water level
+	clock    Clock
+}
+
+type leakyBucket struct {
+	level    float64
+	lastLeak time.Time
+}
+
+// NewLeakyBucket creates a leaky bucket rate limiter that drains rate units per window
+// Capacity defaults to rate if not specified
+func NewLeakyBucket(rate int, window time.Duration, capacity int, opts ...Option) *LeakyBucket {
+	if capacity == 0 {
+		capacity = rate
+	}
+	return &LeakyBucket{
+		buckets:  make(map[string]*leakyBucket),
+		rate:     rate,
+		window:   window,
+		capacity: capacity,
+		clock:    buildOptions(opts).clock,
+	}
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (lb *LeakyBucket) Allow(key string) bool {
+	return lb.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (lb *LeakyBucket) AllowN(key string, n int) bool {
+	return lb.AllowWithInfo(key, n).Allowed
+}
+
+// Reset clears the rate limit state for a key
+func (lb *LeakyBucket) Reset(key string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	delete(lb.buckets, key)
+}
+
+// Refund drains n units of water from the bucket
+func (lb *LeakyBucket) Refund(key string, n int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	b, exists := lb.buckets[key]
+	if !exists {
+		return
+	}
+	b.level = max(b.level-float64(n), 0)
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+func (lb *LeakyBucket) AllowWithInfo(key string, n int) *Result {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.clock.Now()
+	leakRate := float64(lb.rate) / lb.window.Seconds()
+
+	b, exists := lb.buckets[key]
+	if !exists {
+		b = &leakyBucket{lastLeak: now}
+		lb.buckets[key] = b
+	}
+
+	// Drain water for the time elapsed since the last request
+	leaked := leakRate * now.Sub(b.lastLeak).Seconds()
+	b.level = math.Max(b.level-leaked, 0)
+	b.lastLeak = now
+
+	allowed := b.level+float64(n) <= float64(lb.capacity)
+	if allowed {
+		b.level += float64(n)
+	}
+
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     lb.capacity,
+		Remaining: int(float64(lb.capacity) - b.level),
+		// Bucket is back to full capacity once it has drained completely
+		ResetAt: now.Add(time.Duration(b.level * float64(time.Second) / leakRate)),
+	}
+	if !allowed {
+		overflow := b.level + float64(n) - float64(lb.capacity)
+		result.RetryAfter = time.Duration(overflow * float64(time.Second) / leakRate)
+	}
+	return result
+}
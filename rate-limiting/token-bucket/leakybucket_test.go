@@ -0,0 +1,51 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeakyBucket_Leaks(t *testing.T) {
+	// Leaks 10 units/second
+	clock := NewFakeClock(epoch)
+	limiter := NewLeakyBucket(10, time.Second, 10, WithClock(clock))
+	key := "user:alice"
+
+	for i := 0; i < 10; i++ {
+		limiter.Allow(key)
+	}
+	if limiter.Allow(key) {
+		t.Error("Should be denied with a full bucket")
+	}
+
+	// 5 units leak out in 500ms
+	clock.Advance(500 * time.Millisecond)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow(key) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("Expected 5 requests after 500ms, got %d", allowed)
+	}
+}
+
+func TestLeakyBucket_RetryAfter(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewLeakyBucket(10, time.Second, 2, WithClock(clock))
+	key := "user:bob"
+
+	limiter.AllowN(key, 2)
+	result := limiter.AllowWithInfo(key, 1)
+	if result.Allowed {
+		t.Fatal("Should be denied with a full bucket")
+	}
+	// One unit leaks every 100ms
+	if result.RetryAfter != 100*time.Millisecond {
+		t.Errorf("Expected RetryAfter 100ms, got %v", result.RetryAfter)
+	}
+	if want := epoch.Add(200 * time.Millisecond); !result.ResetAt.Equal(want) {
+		t.Errorf("Expected bucket empty at %v, got %v", want, result.ResetAt)
+	}
+}
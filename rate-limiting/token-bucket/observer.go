@@ -0,0 +1,27 @@
+package tokenbucket
+
+// Observer is notified of every rate limit decision, e.g. to export metrics
+// Observe is called synchronously after the decision, outside the limiter's
+// lock, and must be safe for concurrent use.
+type Observer interface {
+	Observe(key string, n int, result *Result)
+}
+
+// ObserverFunc adapts a function to the Observer interface
+type ObserverFunc func(key string, n int, result *Result)
+
+// Observe calls f(key, n, result)
+func (f ObserverFunc) Observe(key string, n int, result *Result) {
+	f(key, n, result)
+}
+
+// WithObserver notifies observer of every Allow, AllowN, AllowWithInfo,
+// Reserve, Wait and Acquire decision of a TokenBucket (or ShardedTokenBucket)
+// A reservation counts as allowed when it is made, even if it is cancelled
+// later. Tokens given back by Refund, Cancel or Settle, and the overage charged
+// by Settle, are not reported: observers see the Acquire estimate.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
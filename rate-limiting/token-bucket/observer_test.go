@@ -0,0 +1,91 @@
+package tokenbucket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Observer(t *testing.T) {
+	type decision struct {
+		key     string
+		n       int
+		allowed bool
+	}
+	var mu sync.Mutex
+	var got []decision
+	observer := ObserverFunc(func(key string, n int, result *Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, decision{key, n, result.Allowed})
+	})
+
+	limiter := NewTokenBucket(10, time.Second, 3, WithClock(NewFakeClock(epoch)), WithObserver(observer))
+	limiter.Allow("user:alice")
+	limiter.AllowN("user:alice", 2)
+	limiter.AllowWithInfo("user:alice", 1)
+
+	want := []decision{
+		{"user:alice", 1, true},
+		{"user:alice", 2, true},
+		{"user:alice", 1, false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d observations, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Observation %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTokenBucket_ObserverSeesReservations(t *testing.T) {
+	var mu sync.Mutex
+	var consumed, allowed, denied int
+	observer := ObserverFunc(func(key string, n int, result *Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if result.Allowed {
+			allowed++
+			consumed += n
+		} else {
+			denied++
+		}
+	})
+
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 5, WithClock(clock), WithObserver(observer))
+	limiter.Reserve("user:alice", 3)
+	limiter.Reserve("user:alice", 6) // Exceeds the burst
+	if err := limiter.Wait(context.Background(), "user:alice", 2); err != nil {
+		t.Fatal(err)
+	}
+	ticket, _ := limiter.Acquire("user:bob", 4)
+	limiter.Settle(ticket, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if allowed != 3 || denied != 1 || consumed != 9 {
+		t.Errorf("Expected 3 allowed, 1 denied and 9 tokens, got %d, %d and %d", allowed, denied, consumed)
+	}
+}
+
+func TestShardedTokenBucket_Observer(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	observer := ObserverFunc(func(string, int, *Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+	})
+
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 4, WithObserver(observer))
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		limiter.Allow(key)
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 observations across shards, got %d", count)
+	}
+}
@@ -0,0 +1,103 @@
+package tokenbucket
+
+import "time"
+
+// Option configures optional limiter behavior
+// Options are passed as trailing arguments to the constructors, e.g.
+//
+//	NewTokenBucket(100, time.Second, 20, WithIdleTTL(10*time.Minute), WithMaxKeys(100000))
+type Option func(*options)
+
+type options struct {
+	clock         Clock         // Time source (defaults to RealClock)
+	idleTTL       time.Duration // Evict full buckets idle for longer than this (0 = never)
+	sweepInterval time.Duration // How often the janitor runs (defaults to idleTTL)
+	maxKeys       int           // Hard cap on tracked keys with LRU eviction (0 = unbounded)
+	failOpen      bool          // Allow requests when the backing store fails
+	observer      Observer      // Notified of every decision (nil = none)
+
+	snapshotPath     string        // File for periodic snapshots ("" = none)
+	snapshotInterval time.Duration // How often to write it (0 = only on Close)
+
+	ticketTTL time.Duration // Lifetime of Acquire tickets (defaults to a minute)
+}
+
+func buildOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.clock == nil {
+		o.clock = RealClock{}
+	}
+	if o.sweepInterval == 0 {
+		o.sweepInterval = o.idleTTL
+	}
+	if o.ticketTTL <= 0 {
+		o.ticketTTL = defaultTicketTTL
+	}
+	return o
+}
+
+// WithClock sets the time source, e.g. a FakeClock in tests
+// Applies to every limiter in this package
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithFailOpen makes a StoreTokenBucket allow requests when its store fails
+// The default is to deny them (fail closed)
+func WithFailOpen() Option {
+	return func(o *options) {
+		o.failOpen = true
+	}
+}
+
+// WithIdleTTL evicts buckets that have refilled to full and not been used for ttl
+// Evicting a full bucket is invisible to callers: a new key starts full anyway.
+// A background janitor does the sweeping, stop it with Close.
+func WithIdleTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.idleTTL = ttl
+	}
+}
+
+// WithSweepInterval sets how often the idle bucket janitor runs
+// Defaults to the idle TTL
+func WithSweepInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.sweepInterval = interval
+	}
+}
+
+// WithMaxKeys caps the number of tracked keys
+// When a new key would exceed the cap the least recently used key is evicted,
+// even if its bucket is not full. This bounds memory when keys are attacker
+// controlled (e.g. client IPs) at the cost of occasionally forgetting a
+// throttled key.
+func WithMaxKeys(n int) Option {
+	return func(o *options) {
+		o.maxKeys = n
+	}
+}
+
+// WithSnapshotFile makes a TokenBucket write a snapshot to path every
+// interval, and once more on Close, replacing the file atomically
+// Restore it on startup with RestoreFile. Applies to TokenBucket and
+// ShardedTokenBucket, which writes all its shards into the one file.
+func WithSnapshotFile(path string, interval time.Duration) Option {
+	return func(o *options) {
+		o.snapshotPath = path
+		o.snapshotInterval = interval
+	}
+}
+
+// WithTicketTTL sets how long a ticket from TokenBucket.Acquire stays open
+// A ticket not settled within ttl counts at its estimate. Defaults to a minute.
+func WithTicketTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ticketTTL = ttl
+	}
+}
@@ -0,0 +1,311 @@
+package tokenbucket
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Forever as a PenaltyConfig.Bans step bans the key permanently
+const Forever time.Duration = -1
+
+// PenaltyConfig configures a PenaltyBox
+type PenaltyConfig struct {
+	// Threshold is the score at which a key is banned
+	Threshold float64
+
+	// HalfLife is how long it takes a score to decay by half (0 = never)
+	HalfLife time.Duration
+
+	// Bans are the durations of a key's 1st, 2nd, ... ban; the last one
+	// repeats. Use Forever as the last step to ban repeat offenders for good.
+	// Defaults to 1m, 10m, 1h.
+	Bans []time.Duration
+
+	// Memory is how long a key must go without a ban before its ban history
+	// is forgotten and escalation starts over (0 = never forget)
+	Memory time.Duration
+}
+
+// PenaltyBox scores misbehaving keys and bans them
+// Every limiter denial or reported protocol violation adds to a key's score,
+// which decays exponentially. When the score crosses the threshold the key is
+// banned, for longer each time it offends again.
+type PenaltyBox struct {
+	mu        sync.Mutex
+	cfg       PenaltyConfig
+	clock     Clock
+	offenders map[string]*offender
+	permanent map[string]struct{}
+	sweepAt   int // Offender count at which the next new key triggers a sweep
+}
+
+// Fewest offenders worth sweeping for
+const minPenaltySweep = 1024
+
+type offender struct {
+	score       float64
+	updated     time.Time // When score was last decayed
+	bans        int       // Bans so far, selects the next ban duration
+	lastBan     time.Time
+	bannedUntil time.Time
+}
+
+// Ban is an entry of PenaltyBox.BanList
+type Ban struct {
+	Key       string
+	Until     time.Time // Zero for permanent bans
+	Permanent bool
+}
+
+// NewPenaltyBox creates a penalty box
+func NewPenaltyBox(cfg PenaltyConfig, opts ...Option) *PenaltyBox {
+	if len(cfg.Bans) == 0 {
+		cfg.Bans = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+	}
+	o := buildOptions(opts)
+	return &PenaltyBox{
+		cfg:       cfg,
+		clock:     o.clock,
+		offenders: make(map[string]*offender),
+		permanent: make(map[string]struct{}),
+		sweepAt:   minPenaltySweep,
+	}
+}
+
+// Penalize adds score to key and bans it if the threshold is crossed
+// Returns whether key is banned afterwards. Penalties while banned are ignored.
+func (pb *PenaltyBox) Penalize(key string, score float64) bool {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if _, ok := pb.permanent[key]; ok {
+		return true
+	}
+	now := pb.clock.Now()
+	o := pb.lookup(key, now)
+	if o == nil {
+		o = pb.add(key, now)
+	}
+	if now.Before(o.bannedUntil) {
+		return true
+	}
+
+	pb.decay(o, now)
+	if pb.cfg.Memory > 0 && o.bans > 0 && now.Sub(o.lastBan) > pb.cfg.Memory {
+		o.bans = 0
+	}
+	o.score += score
+	if o.score < pb.cfg.Threshold {
+		return false
+	}
+
+	// Crossed the threshold: ban for the next step and start scoring afresh
+	step := pb.cfg.Bans[min(o.bans, len(pb.cfg.Bans)-1)]
+	o.bans++
+	o.lastBan = now
+	o.score = 0
+	if step == Forever {
+		delete(pb.offenders, key)
+		pb.permanent[key] = struct{}{}
+		return true
+	}
+	o.bannedUntil = now.Add(step)
+	return true
+}
+
+// IsBanned reports whether key is currently banned
+func (pb *PenaltyBox) IsBanned(key string) bool {
+	_, banned := pb.BannedUntil(key)
+	return banned
+}
+
+// BannedUntil returns when key's ban ends and whether it is banned
+// Permanent bans return the zero time.
+func (pb *PenaltyBox) BannedUntil(key string) (time.Time, bool) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if _, ok := pb.permanent[key]; ok {
+		return time.Time{}, true
+	}
+	now := pb.clock.Now()
+	o := pb.lookup(key, now)
+	if o == nil || !now.Before(o.bannedUntil) {
+		return time.Time{}, false
+	}
+	return o.bannedUntil, true
+}
+
+// Score returns key's current, decayed score
+func (pb *PenaltyBox) Score(key string) float64 {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	o := pb.lookup(key, pb.clock.Now())
+	if o == nil {
+		return 0
+	}
+	return o.score
+}
+
+// Ban bans key for d regardless of its score (Forever = permanently)
+func (pb *PenaltyBox) Ban(key string, d time.Duration) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if d == Forever {
+		delete(pb.offenders, key)
+		pb.permanent[key] = struct{}{}
+		return
+	}
+	now := pb.clock.Now()
+	o := pb.lookup(key, now)
+	if o == nil {
+		o = pb.add(key, now)
+	}
+	o.bans++
+	o.lastBan = now
+	o.bannedUntil = now.Add(d)
+}
+
+// Unban lifts any ban on key and forgets its score and ban history
+func (pb *PenaltyBox) Unban(key string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	delete(pb.offenders, key)
+	delete(pb.permanent, key)
+}
+
+// BanList returns all current bans sorted by key
+func (pb *PenaltyBox) BanList() []Ban {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	now := pb.clock.Now()
+	var bans []Ban
+	for key := range pb.permanent {
+		bans = append(bans, Ban{Key: key, Permanent: true})
+	}
+	for key, o := range pb.offenders {
+		if now.Before(o.bannedUntil) {
+			bans = append(bans, Ban{Key: key, Until: o.bannedUntil})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Key < bans[j].Key
+	})
+	return bans
+}
+
+// Return key's offender record, nil if there is none worth keeping
+// A record that has become forgettable is deleted. Caller must hold pb.mu
+func (pb *PenaltyBox) lookup(key string, now time.Time) *offender {
+	o := pb.offenders[key]
+	if o != nil && pb.forgettable(o, now) {
+		delete(pb.offenders, key)
+		return nil
+	}
+	return o
+}
+
+// Start a record for key
+// Every time the number of offenders doubles, the forgettable ones are swept
+// out first, so keys that are never seen again don't pile up.
+// Caller must hold pb.mu
+func (pb *PenaltyBox) add(key string, now time.Time) *offender {
+	if len(pb.offenders) >= pb.sweepAt {
+		for k, o := range pb.offenders {
+			if pb.forgettable(o, now) {
+				delete(pb.offenders, k)
+			}
+		}
+		pb.sweepAt = max(2*len(pb.offenders), minPenaltySweep)
+	}
+	o := &offender{updated: now}
+	pb.offenders[key] = o
+	return o
+}
+
+// Whether o is not banned, its score has decayed to noise and its ban
+// history is forgotten, so dropping it changes nothing
+// Caller must hold pb.mu
+func (pb *PenaltyBox) forgettable(o *offender, now time.Time) bool {
+	if now.Before(o.bannedUntil) {
+		return false
+	}
+	pb.decay(o, now)
+	forgotten := o.bans == 0 || (pb.cfg.Memory > 0 && now.Sub(o.lastBan) > pb.cfg.Memory)
+	return forgotten && o.score < pb.cfg.Threshold/100
+}
+
+// Decay o's score for the time elapsed until now
+// Caller must hold pb.mu
+func (pb *PenaltyBox) decay(o *offender, now time.Time) {
+	if pb.cfg.HalfLife > 0 && now.After(o.updated) {
+		halvings := float64(now.Sub(o.updated)) / float64(pb.cfg.HalfLife)
+		o.score *= math.Pow(0.5, halvings)
+	}
+	o.updated = now
+}
+
+// PenaltyLimiter wraps a Limiter, denying banned keys without consulting it
+// and penalizing keys each time the wrapped limiter denies them, so peers
+// that keep hammering their limit end up banned.
+type PenaltyLimiter struct {
+	limiter Limiter
+	box     *PenaltyBox
+	score   float64
+}
+
+// NewPenaltyLimiter creates a limiter that adds denialScore to a key's score
+// in box on every denial
+func NewPenaltyLimiter(limiter Limiter, box *PenaltyBox, denialScore float64) *PenaltyLimiter {
+	return &PenaltyLimiter{limiter: limiter, box: box, score: denialScore}
+}
+
+// Allow checks if a single request is allowed
+func (pl *PenaltyLimiter) Allow(key string) bool {
+	return pl.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed
+func (pl *PenaltyLimiter) AllowN(key string, n int) bool {
+	return pl.AllowWithInfo(key, n).Allowed
+}
+
+// AllowWithInfo denies banned keys outright, RetryAfter is the rest of the
+// ban (0 for permanent bans) and Limit and Remaining are 0
+func (pl *PenaltyLimiter) AllowWithInfo(key string, n int) *Result {
+	if until, banned := pl.box.BannedUntil(key); banned {
+		result := &Result{ResetAt: until}
+		if !until.IsZero() {
+			result.RetryAfter = until.Sub(pl.box.clock.Now())
+		}
+		return result
+	}
+
+	result := pl.limiter.AllowWithInfo(key, n)
+	if !result.Allowed && pl.score > 0 {
+		if pl.box.Penalize(key, pl.score) {
+			if until, _ := pl.box.BannedUntil(key); !until.IsZero() {
+				result.RetryAfter = until.Sub(pl.box.clock.Now())
+				result.ResetAt = until
+			}
+		}
+	}
+	return result
+}
+
+// Reset clears the wrapped limiter's state for key, bans are kept
+func (pl *PenaltyLimiter) Reset(key string) {
+	pl.limiter.Reset(key)
+}
+
+// Refund gives n units back to the wrapped limiter if it can refund
+func (pl *PenaltyLimiter) Refund(key string, n int) {
+	if r, ok := pl.limiter.(Refunder); ok {
+		r.Refund(key, n)
+	}
+}
@@ -0,0 +1,204 @@
+package tokenbucket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPenaltyBox_BanAtThreshold(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{Threshold: 10}, WithClock(clock))
+
+	if box.Penalize("peer:a", 6) {
+		t.Error("Score below threshold should not ban")
+	}
+	if !box.Penalize("peer:a", 4) {
+		t.Error("Reaching the threshold should ban")
+	}
+	until, banned := box.BannedUntil("peer:a")
+	if !banned || !until.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("Expected first ban until %v, got %v, %v", epoch.Add(time.Minute), until, banned)
+	}
+	if box.IsBanned("peer:b") {
+		t.Error("Other keys should not be banned")
+	}
+
+	clock.Advance(time.Minute)
+	if box.IsBanned("peer:a") {
+		t.Error("Ban should expire")
+	}
+	if score := box.Score("peer:a"); score != 0 {
+		t.Errorf("Score should restart from 0 after a ban, got %v", score)
+	}
+}
+
+func TestPenaltyBox_Decay(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{Threshold: 10, HalfLife: time.Minute}, WithClock(clock))
+
+	box.Penalize("peer:a", 8)
+	clock.Advance(time.Minute)
+	if score := box.Score("peer:a"); score != 4 {
+		t.Errorf("Expected score halved to 4, got %v", score)
+	}
+	// 4 + 5 stays under the threshold thanks to decay
+	if box.Penalize("peer:a", 5) {
+		t.Error("Decayed score should not reach the threshold")
+	}
+}
+
+func TestPenaltyBox_Escalation(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{
+		Threshold: 1,
+		Bans:      []time.Duration{time.Minute, time.Hour, Forever},
+		Memory:    24 * time.Hour,
+	}, WithClock(clock))
+
+	for _, want := range []time.Duration{time.Minute, time.Hour} {
+		box.Penalize("peer:a", 1)
+		until, _ := box.BannedUntil("peer:a")
+		if got := until.Sub(clock.Now()); got != want {
+			t.Errorf("Expected ban of %v, got %v", want, got)
+		}
+		clock.Advance(want)
+	}
+
+	box.Penalize("peer:a", 1)
+	clock.Advance(365 * 24 * time.Hour)
+	if until, banned := box.BannedUntil("peer:a"); !banned || !until.IsZero() {
+		t.Error("Third offence should ban permanently")
+	}
+
+	// A key that stays clean long enough starts over
+	box.Penalize("peer:b", 1)
+	clock.Advance(time.Minute)
+	box.Penalize("peer:b", 1)
+	clock.Advance(time.Hour + 25*time.Hour)
+	box.Penalize("peer:b", 1)
+	until, _ := box.BannedUntil("peer:b")
+	if got := until.Sub(clock.Now()); got != time.Minute {
+		t.Errorf("Expected escalation to reset after Memory, got ban of %v", got)
+	}
+}
+
+func TestPenaltyBox_BanListAndUnban(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{Threshold: 1}, WithClock(clock))
+
+	box.Penalize("peer:b", 1)
+	box.Ban("peer:a", Forever)
+	box.Ban("peer:c", time.Hour)
+
+	bans := box.BanList()
+	want := []Ban{
+		{Key: "peer:a", Permanent: true},
+		{Key: "peer:b", Until: epoch.Add(time.Minute)},
+		{Key: "peer:c", Until: epoch.Add(time.Hour)},
+	}
+	if len(bans) != len(want) {
+		t.Fatalf("Expected %d bans, got %+v", len(want), bans)
+	}
+	for i := range want {
+		if bans[i] != want[i] {
+			t.Errorf("BanList()[%d] = %+v, want %+v", i, bans[i], want[i])
+		}
+	}
+
+	box.Unban("peer:a")
+	box.Unban("peer:c")
+	if box.IsBanned("peer:a") || box.IsBanned("peer:c") {
+		t.Error("Unban should lift temporary and permanent bans")
+	}
+	if bans := box.BanList(); len(bans) != 1 {
+		t.Errorf("Expected 1 ban left, got %+v", bans)
+	}
+}
+
+func TestPenaltyBox_ForgetsCleanKeys(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{Threshold: 10, HalfLife: time.Second}, WithClock(clock))
+
+	box.Penalize("peer:a", 5)
+	clock.Advance(time.Minute)
+	if score := box.Score("peer:a"); score != 0 {
+		t.Errorf("Expected decayed score 0, got %v", score)
+	}
+	if len(box.offenders) != 0 {
+		t.Errorf("Expected decayed offender to be dropped on access, %d left", len(box.offenders))
+	}
+
+	// Keys that are never seen again are swept as new ones arrive
+	for i := 0; i < 10*minPenaltySweep; i++ {
+		box.Penalize(fmt.Sprintf("peer:%d", i), 5)
+		clock.Advance(time.Second)
+	}
+	if len(box.offenders) > 2*minPenaltySweep {
+		t.Errorf("Expected decayed offenders to be swept, %d left", len(box.offenders))
+	}
+
+	// Banned keys and remembered history are kept
+	box = NewPenaltyBox(PenaltyConfig{Threshold: 10, HalfLife: time.Second}, WithClock(clock))
+	box.Penalize("peer:banned", 10)
+	for i := 0; i < 2*minPenaltySweep; i++ {
+		box.Penalize(fmt.Sprintf("peer:%d", i), 5)
+		clock.Advance(time.Millisecond)
+	}
+	if !box.IsBanned("peer:banned") {
+		t.Error("Sweep should keep banned keys")
+	}
+}
+
+func TestPenaltyLimiter(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{Threshold: 3}, WithClock(clock))
+	inner := NewTokenBucket(1, time.Second, 1, WithClock(clock))
+	limiter := NewPenaltyLimiter(inner, box, 1)
+
+	if !limiter.Allow("peer:a") {
+		t.Fatal("First request should be allowed")
+	}
+	for i := 0; i < 3; i++ {
+		limiter.Allow("peer:a")
+	}
+	if !box.IsBanned("peer:a") {
+		t.Fatal("Three denials should ban the key")
+	}
+
+	// Banned keys are denied even with tokens available
+	clock.Advance(30 * time.Second)
+	result := limiter.AllowWithInfo("peer:a", 1)
+	if result.Allowed {
+		t.Error("Banned key should be denied")
+	}
+	if result.RetryAfter != 30*time.Second {
+		t.Errorf("Expected RetryAfter of the remaining ban 30s, got %v", result.RetryAfter)
+	}
+
+	clock.Advance(30 * time.Second)
+	if !limiter.Allow("peer:a") {
+		t.Error("Key should be allowed after the ban")
+	}
+}
+
+func TestPenaltyLimiter_InComposite(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	box := NewPenaltyBox(PenaltyConfig{Threshold: 100}, WithClock(clock))
+	perKey := NewPenaltyLimiter(NewTokenBucket(10, time.Minute, 10, WithClock(clock)), box, 1)
+	global := NewTokenBucket(1, time.Minute, 1, WithClock(clock))
+
+	limiter, err := NewComposite(
+		Tier{Name: "peer", Limiter: perKey},
+		Tier{Name: "global", Limiter: global, Key: FixedKey("global")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.Allow("peer:a")
+	limiter.Allow("peer:a") // Denied globally, the peer tier is refunded
+
+	if result := perKey.AllowWithInfo("peer:a", 0); result.Remaining != 9 {
+		t.Errorf("Expected peer tier refunded to 9, got %d", result.Remaining)
+	}
+}
@@ -0,0 +1,308 @@
+package tokenbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Policy is the rate configuration applied to a key
+// Plans with different quotas are expressed as per-key or per-prefix
+// policies on one TokenBucket, e.g. "plan:gold:*" -> 1000/minute.
+type Policy struct {
+	Rate      int           // Tokens per window
+	Window    time.Duration // Time window for rate
+	BurstSize int           // Max tokens in bucket
+}
+
+// NewPolicy creates a policy, defaulting burst size to rate if not specified
+func NewPolicy(rate int, window time.Duration, burstSize int) Policy {
+	if burstSize == 0 {
+		burstSize = rate
+	}
+	return Policy{Rate: rate, Window: window, BurstSize: burstSize}
+}
+
+// Tokens added per second
+func (p Policy) refillRate() float64 {
+	return float64(p.Rate) / p.Window.Seconds()
+}
+
+// Add the tokens earned since the last refill, up to the burst size
+func (p Policy) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.lastRefill)
+	b.tokens = math.Min(b.tokens+p.refillRate()*elapsed.Seconds(), float64(p.BurstSize))
+	b.lastRefill = now
+}
+
+func (p Policy) validate() error {
+	if p.Rate <= 0 || p.Window <= 0 || p.BurstSize <= 0 {
+		return fmt.Errorf("tokenbucket: invalid policy %+v: rate, window and burst must be positive", p)
+	}
+	return nil
+}
+
+// An override matching every key that starts with prefix
+type prefixPolicy struct {
+	prefix string
+	policy Policy
+}
+
+// Resolve the policy for key: exact override, then longest prefix, then default
+// Caller must hold tb.mu
+func (tb *TokenBucket) policyFor(key string) Policy {
+	if p, ok := tb.overrides[key]; ok {
+		return p
+	}
+	for _, pp := range tb.prefixes {
+		if strings.HasPrefix(key, pp.prefix) {
+			return pp.policy
+		}
+	}
+	return tb.policy
+}
+
+// PolicyFor returns the policy in effect for key
+func (tb *TokenBucket) PolicyFor(key string) Policy {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.policyFor(key)
+}
+
+// DefaultPolicy returns the policy for keys without an override
+func (tb *TokenBucket) DefaultPolicy() Policy {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.policy
+}
+
+// SetDefaultPolicy changes the policy for keys without an override
+// Existing balances are kept, see SetPolicy.
+func (tb *TokenBucket) SetDefaultPolicy(p Policy) error {
+	p = NewPolicy(p.Rate, p.Window, p.BurstSize)
+	if err := p.validate(); err != nil {
+		return err
+	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.reconfigure(func() {
+		tb.policy = p
+	})
+	return nil
+}
+
+// SetPolicy sets an override for pattern, either an exact key ("user:alice")
+// or a prefix ending in '*' ("plan:gold:*"). Exact keys win over prefixes and
+// longer prefixes win over shorter ones.
+//
+// Affected buckets keep their token balance: they are refilled under the old
+// rate up to now, and if the burst size shrinks the balance is scaled down
+// proportionally (a half full bucket stays half full).
+func (tb *TokenBucket) SetPolicy(pattern string, p Policy) error {
+	p = NewPolicy(p.Rate, p.Window, p.BurstSize)
+	if err := p.validate(); err != nil {
+		return err
+	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.reconfigure(func() {
+		tb.setOverride(pattern, p)
+	})
+	return nil
+}
+
+// Policy returns the override set for pattern, if any
+func (tb *TokenBucket) Policy(pattern string) (Policy, bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		for _, pp := range tb.prefixes {
+			if pp.prefix == prefix {
+				return pp.policy, true
+			}
+		}
+		return Policy{}, false
+	}
+	p, ok := tb.overrides[pattern]
+	return p, ok
+}
+
+// RemovePolicy removes the override for pattern
+// Affected keys fall back to the next matching prefix or the default.
+func (tb *TokenBucket) RemovePolicy(pattern string) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.reconfigure(func() {
+		tb.removeOverride(pattern)
+	})
+}
+
+// PolicySet is a complete policy configuration, usually loaded from JSON
+type PolicySet struct {
+	// Default replaces the default policy if set
+	Default *Policy
+
+	// Overrides maps exact keys or "prefix*" patterns to policies
+	Overrides map[string]Policy
+}
+
+// ApplyPolicies atomically replaces the default (if set) and all overrides
+func (tb *TokenBucket) ApplyPolicies(set *PolicySet) error {
+	if err := set.validate(); err != nil {
+		return err
+	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.reconfigure(func() {
+		if set.Default != nil {
+			tb.policy = NewPolicy(set.Default.Rate, set.Default.Window, set.Default.BurstSize)
+		}
+		tb.overrides = make(map[string]Policy)
+		tb.prefixes = nil
+		for pattern, p := range set.Overrides {
+			tb.setOverride(pattern, NewPolicy(p.Rate, p.Window, p.BurstSize))
+		}
+	})
+	return nil
+}
+
+func (set *PolicySet) validate() error {
+	if set.Default != nil {
+		if err := NewPolicy(set.Default.Rate, set.Default.Window, set.Default.BurstSize).validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for pattern, p := range set.Overrides {
+		if err := NewPolicy(p.Rate, p.Window, p.BurstSize).validate(); err != nil {
+			return fmt.Errorf("%s: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// JSON policy file format, windows are Go durations:
+//
+//	{
+//	  "default":   {"rate": 100, "window": "1m", "burst": 20},
+//	  "overrides": {
+//	    "plan:gold:*": {"rate": 1000, "window": "1m", "burst": 200},
+//	    "user:alice":  {"rate": 10, "window": "1s"}
+//	  }
+//	}
+type policyFile struct {
+	Default   *policyJSON           `json:"default"`
+	Overrides map[string]policyJSON `json:"overrides"`
+}
+
+type policyJSON struct {
+	Rate   int    `json:"rate"`
+	Window string `json:"window"`
+	Burst  int    `json:"burst"`
+}
+
+func (pj policyJSON) policy() (Policy, error) {
+	window, err := time.ParseDuration(pj.Window)
+	if err != nil {
+		return Policy{}, err
+	}
+	return NewPolicy(pj.Rate, window, pj.Burst), nil
+}
+
+// ParsePolicies reads a JSON policy configuration
+func ParsePolicies(r io.Reader) (*PolicySet, error) {
+	var file policyFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("tokenbucket: parsing policies: %w", err)
+	}
+
+	set := &PolicySet{Overrides: make(map[string]Policy)}
+	if file.Default != nil {
+		p, err := file.Default.policy()
+		if err != nil {
+			return nil, fmt.Errorf("tokenbucket: default policy: %w", err)
+		}
+		set.Default = &p
+	}
+	for pattern, pj := range file.Overrides {
+		p, err := pj.policy()
+		if err != nil {
+			return nil, fmt.Errorf("tokenbucket: policy %s: %w", pattern, err)
+		}
+		set.Overrides[pattern] = p
+	}
+	if err := set.validate(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// LoadPolicyFile reads a JSON policy configuration from path
+func LoadPolicyFile(path string) (*PolicySet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePolicies(f)
+}
+
+// Apply a policy change without losing token balances
+// Every bucket is settled under its old policy, the change is applied,
+// and buckets whose burst size shrank are scaled down.
+// Caller must hold tb.mu
+func (tb *TokenBucket) reconfigure(change func()) {
+	now := tb.clock.Now()
+	before := make(map[string]Policy, len(tb.buckets))
+	for key, b := range tb.buckets {
+		p := tb.policyFor(key)
+		p.refill(b, now)
+		before[key] = p
+	}
+
+	change()
+
+	for key, b := range tb.buckets {
+		old, p := before[key], tb.policyFor(key)
+		if p.BurstSize < old.BurstSize {
+			b.tokens *= float64(p.BurstSize) / float64(old.BurstSize)
+		}
+	}
+}
+
+// Caller must hold tb.mu
+func (tb *TokenBucket) setOverride(pattern string, p Policy) {
+	prefix, isPrefix := strings.CutSuffix(pattern, "*")
+	if !isPrefix {
+		tb.overrides[pattern] = p
+		return
+	}
+	tb.removeOverride(pattern)
+	tb.prefixes = append(tb.prefixes, prefixPolicy{prefix: prefix, policy: p})
+	// Longest prefix first so the first match is the most specific
+	sort.SliceStable(tb.prefixes, func(i, j int) bool {
+		return len(tb.prefixes[i].prefix) > len(tb.prefixes[j].prefix)
+	})
+}
+
+// Caller must hold tb.mu
+func (tb *TokenBucket) removeOverride(pattern string) {
+	prefix, isPrefix := strings.CutSuffix(pattern, "*")
+	if !isPrefix {
+		delete(tb.overrides, pattern)
+		return
+	}
+	for i, pp := range tb.prefixes {
+		if pp.prefix == prefix {
+			tb.prefixes = append(tb.prefixes[:i], tb.prefixes[i+1:]...)
+			return
+		}
+	}
+}
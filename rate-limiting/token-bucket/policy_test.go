@@ -0,0 +1,208 @@
+package tokenbucket
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_PolicyMatching(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Minute, 10, WithClock(NewFakeClock(epoch)))
+	gold := Policy{Rate: 1000, Window: time.Minute, BurstSize: 100}
+	goldEU := Policy{Rate: 500, Window: time.Minute, BurstSize: 50}
+	alice := Policy{Rate: 1, Window: time.Second, BurstSize: 1}
+
+	for pattern, p := range map[string]Policy{
+		"plan:gold:*":    gold,
+		"plan:gold:eu:*": goldEU,
+		"plan:gold:bob":  alice,
+	} {
+		if err := limiter.SetPolicy(pattern, p); err != nil {
+			t.Fatalf("SetPolicy(%q): %v", pattern, err)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want Policy
+	}{
+		{"plan:gold:alice", gold},
+		{"plan:gold:eu:alice", goldEU},
+		{"plan:gold:bob", alice},
+		{"plan:silver:alice", limiter.DefaultPolicy()},
+	}
+	for _, tt := range tests {
+		if got := limiter.PolicyFor(tt.key); got != tt.want {
+			t.Errorf("PolicyFor(%q) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+
+	result := limiter.AllowWithInfo("plan:gold:alice", 1)
+	if result.Limit != 100 || result.Remaining != 99 {
+		t.Errorf("Expected limit 100, remaining 99 for gold key, got %d, %d", result.Limit, result.Remaining)
+	}
+
+	limiter.RemovePolicy("plan:gold:eu:*")
+	if got := limiter.PolicyFor("plan:gold:eu:alice"); got != gold {
+		t.Errorf("Expected fallback to shorter prefix after removal, got %+v", got)
+	}
+	if _, ok := limiter.Policy("plan:gold:eu:*"); ok {
+		t.Error("Removed policy still reported")
+	}
+	if p, ok := limiter.Policy("plan:gold:*"); !ok || p != gold {
+		t.Errorf("Policy(plan:gold:*) = %+v, %v", p, ok)
+	}
+}
+
+func TestTokenBucket_PolicyDefaultsBurst(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Minute, 10)
+	if err := limiter.SetPolicy("k", Policy{Rate: 30, Window: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.PolicyFor("k").BurstSize; got != 30 {
+		t.Errorf("Expected burst to default to rate, got %d", got)
+	}
+}
+
+func TestTokenBucket_PolicyInvalid(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Minute, 10)
+	for _, p := range []Policy{
+		{Rate: 0, Window: time.Minute},
+		{Rate: 10, Window: 0},
+		{Rate: 10, Window: time.Minute, BurstSize: -1},
+	} {
+		if err := limiter.SetPolicy("k", p); err == nil {
+			t.Errorf("SetPolicy(%+v) should fail", p)
+		}
+	}
+	if err := limiter.SetDefaultPolicy(Policy{}); err == nil {
+		t.Error("SetDefaultPolicy with zero policy should fail")
+	}
+}
+
+func TestTokenBucket_PolicyChangeKeepsBalance(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(60, time.Minute, 10, WithClock(clock))
+
+	limiter.AllowN("user:alice", 10)
+	clock.Advance(5 * time.Second) // 5 tokens earned at the old rate
+
+	// Raising the burst size keeps the balance, it does not refill the bucket
+	if err := limiter.SetPolicy("user:*", Policy{Rate: 600, Window: time.Minute, BurstSize: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if result := limiter.AllowWithInfo("user:alice", 0); result.Remaining != 5 {
+		t.Errorf("Expected balance 5 after raising limit, got %d", result.Remaining)
+	}
+
+	// The new rate applies from the change onwards
+	clock.Advance(time.Second)
+	if result := limiter.AllowWithInfo("user:alice", 0); result.Remaining != 15 {
+		t.Errorf("Expected 15 tokens one second after change, got %d", result.Remaining)
+	}
+}
+
+func TestTokenBucket_PolicyShrinkScalesBalance(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(100, time.Minute, 100, WithClock(clock))
+
+	limiter.AllowN("user:alice", 50)
+	if err := limiter.SetDefaultPolicy(Policy{Rate: 10, Window: time.Minute, BurstSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	// Half full stays half full
+	if result := limiter.AllowWithInfo("user:alice", 0); result.Remaining != 5 {
+		t.Errorf("Expected balance scaled to 5, got %d", result.Remaining)
+	}
+	// Untouched keys start with the new burst size
+	if result := limiter.AllowWithInfo("user:bob", 0); result.Remaining != 10 {
+		t.Errorf("Expected new key to get 10 tokens, got %d", result.Remaining)
+	}
+}
+
+const testPolicies = `{
+  "default": {"rate": 100, "window": "1m", "burst": 20},
+  "overrides": {
+    "plan:gold:*": {"rate": 1000, "window": "1m", "burst": 200},
+    "user:alice":  {"rate": 10, "window": "1s"}
+  }
+}`
+
+func TestParsePolicies(t *testing.T) {
+	set, err := ParsePolicies(strings.NewReader(testPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Default == nil || *set.Default != (Policy{Rate: 100, Window: time.Minute, BurstSize: 20}) {
+		t.Errorf("Unexpected default %+v", set.Default)
+	}
+	if got := set.Overrides["user:alice"]; got != (Policy{Rate: 10, Window: time.Second, BurstSize: 10}) {
+		t.Errorf("Unexpected user:alice policy %+v", got)
+	}
+
+	limiter := NewTokenBucket(1, time.Second, 1)
+	if err := limiter.ApplyPolicies(set); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.PolicyFor("plan:gold:acme").BurstSize; got != 200 {
+		t.Errorf("Expected gold burst 200, got %d", got)
+	}
+	if got := limiter.PolicyFor("anyone").BurstSize; got != 20 {
+		t.Errorf("Expected default burst 20, got %d", got)
+	}
+
+	// Applying a new set replaces all overrides
+	if err := limiter.ApplyPolicies(&PolicySet{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := limiter.Policy("plan:gold:*"); ok {
+		t.Error("Expected overrides to be replaced")
+	}
+	if got := limiter.PolicyFor("anyone").BurstSize; got != 20 {
+		t.Errorf("Expected default to be kept when unset, got %d", got)
+	}
+}
+
+func TestParsePolicies_Invalid(t *testing.T) {
+	for name, input := range map[string]string{
+		"syntax":        `{"default": `,
+		"bad window":    `{"default": {"rate": 1, "window": "soon"}}`,
+		"zero rate":     `{"overrides": {"k": {"rate": 0, "window": "1s"}}}`,
+		"unknown field": `{"defaults": {"rate": 1, "window": "1s"}}`,
+	} {
+		if _, err := ParsePolicies(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, []byte(testPolicies), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Overrides) != 2 {
+		t.Errorf("Expected 2 overrides, got %d", len(set.Overrides))
+	}
+	if _, err := LoadPolicyFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestShardedTokenBucket_Policies(t *testing.T) {
+	limiter := NewShardedTokenBucket(10, time.Minute, 10, 8)
+	if err := limiter.SetPolicy("plan:gold:*", Policy{Rate: 100, Window: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"plan:gold:a", "plan:gold:b", "plan:gold:c"} {
+		if result := limiter.AllowWithInfo(key, 1); result.Limit != 100 {
+			t.Errorf("Expected gold limit on %q, got %d", key, result.Limit)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tokenbucket
+
+import (
+	"sync"
+	"time"
+)
+
+// Period is the calendar unit a Quota resets on
+type Period int
+
+const (
+	// Daily quotas reset at midnight
+	Daily Period = iota
+
+	// Weekly quotas reset at midnight on Monday
+	Weekly
+
+	// Monthly quotas reset at midnight on the 1st
+	Monthly
+)
+
+// Quota limits usage per calendar period, e.g. 100k calls per month
+// Unlike the other limiters, periods are aligned to the calendar in the
+// quota's time zone rather than to a key's first request, so all keys reset
+// together and DST shifts are honoured (a day may be 23 or 25 hours long).
+//
+// Quotas bill long-term usage; combine one with a TokenBucket in a Composite
+// to enforce "5k per day, 10 per second" in a single check.
+type Quota struct {
+	mu     sync.Mutex
+	used   map[string]int // Usage in the current period
+	limit  int            // Max usage per period
+	period Period
+	loc    *time.Location
+	clock  Clock
+	start  time.Time // Start of the current period
+	end    time.Time // Start of the next period
+}
+
+// NewQuota creates a quota of limit per period, with periods aligned to the calendar in loc
+// A nil loc means UTC.
+func NewQuota(limit int, period Period, loc *time.Location, opts ...Option) *Quota {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Quota{
+		used:   make(map[string]int),
+		limit:  limit,
+		period: period,
+		loc:    loc,
+		clock:  buildOptions(opts).clock,
+	}
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (q *Quota) Allow(key string) bool {
+	return q.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (q *Quota) AllowN(key string, n int) bool {
+	return q.AllowWithInfo(key, n).Allowed
+}
+
+// AllowWithInfo returns detailed information about the quota check
+// A denied request has to wait for the next period, RetryAfter says how long.
+func (q *Quota) AllowWithInfo(key string, n int) *Result {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.clock.Now()
+	q.rollover(now)
+
+	used := q.used[key]
+	allowed := used+n <= q.limit
+	if allowed && n > 0 {
+		used += n
+		q.used[key] = used
+	}
+
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     q.limit,
+		Remaining: q.limit - used,
+		ResetAt:   q.end,
+	}
+	if !allowed {
+		result.RetryAfter = q.end.Sub(now)
+	}
+	return result
+}
+
+// Usage returns how much of its quota key has used in the current period
+// and when the quota resets
+func (q *Quota) Usage(key string) (used, limit int, resetsAt time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(q.clock.Now())
+	return q.used[key], q.limit, q.end
+}
+
+// Reset clears the usage for a key
+func (q *Quota) Reset(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.used, key)
+}
+
+// Refund gives n units back to key's usage in the current period
+func (q *Quota) Refund(key string, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(q.clock.Now())
+	if used := q.used[key] - n; used > 0 {
+		q.used[key] = used
+	} else {
+		delete(q.used, key)
+	}
+}
+
+// Start a new period if now is past the current one
+// Every key resets at the same boundary, so usage is simply dropped. Periods
+// only roll forward: a clock stepping back before the period start keeps the
+// current period and its usage, or it would be cleared twice.
+// Caller must hold q.mu
+func (q *Quota) rollover(now time.Time) {
+	if !q.end.IsZero() && now.Before(q.end) {
+		return
+	}
+	q.start, q.end = q.period.bounds(now.In(q.loc))
+	q.used = make(map[string]int)
+}
+
+// Start of the period containing t and start of the next one, in t's location
+func (p Period) bounds(t time.Time) (start, end time.Time) {
+	year, month, day := t.Date()
+	switch p {
+	case Weekly:
+		// Weekday counts from Sunday, ISO weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		start = time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 7)
+	case Monthly:
+		start = time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 1)
+	}
+}
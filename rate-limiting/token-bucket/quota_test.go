@@ -0,0 +1,181 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Don't depend on the host's zoneinfo
+)
+
+func TestQuota_DailyReset(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC))
+	quota := NewQuota(3, Daily, nil, WithClock(clock))
+
+	if !quota.AllowN("user:alice", 3) {
+		t.Fatal("Requests within quota should be allowed")
+	}
+	result := quota.AllowWithInfo("user:alice", 1)
+	if result.Allowed {
+		t.Error("Request over quota should be denied")
+	}
+	if result.RetryAfter != time.Hour {
+		t.Errorf("Expected RetryAfter until midnight (1h), got %v", result.RetryAfter)
+	}
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC); !result.ResetAt.Equal(want) {
+		t.Errorf("Expected ResetAt %v, got %v", want, result.ResetAt)
+	}
+
+	// Calendar aligned: resets at midnight, not 24h after the first request
+	clock.Advance(time.Hour)
+	if !quota.Allow("user:alice") {
+		t.Error("Quota should reset at midnight")
+	}
+}
+
+func TestQuota_Usage(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC))
+	quota := NewQuota(100000, Monthly, nil, WithClock(clock))
+
+	quota.AllowN("user:alice", 1500)
+	used, limit, resetsAt := quota.Usage("user:alice")
+	if used != 1500 || limit != 100000 {
+		t.Errorf("Expected 1500/100000 used, got %d/%d", used, limit)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !resetsAt.Equal(want) {
+		t.Errorf("Expected reset on %v, got %v", want, resetsAt)
+	}
+
+	quota.Refund("user:alice", 500)
+	if used, _, _ := quota.Usage("user:alice"); used != 1000 {
+		t.Errorf("Expected 1000 used after refund, got %d", used)
+	}
+	quota.Reset("user:alice")
+	if used, _, _ := quota.Usage("user:alice"); used != 0 {
+		t.Errorf("Expected 0 used after reset, got %d", used)
+	}
+}
+
+func TestQuota_TimeZone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		period Period
+		now    time.Time
+		start  time.Time
+		end    time.Time
+	}{
+		{
+			// 03:00 UTC is still the previous day in New York
+			name:   "daily in zone",
+			period: Daily,
+			now:    time.Date(2024, 1, 15, 3, 0, 0, 0, time.UTC),
+			start:  time.Date(2024, 1, 14, 0, 0, 0, 0, ny),
+			end:    time.Date(2024, 1, 15, 0, 0, 0, 0, ny),
+		},
+		{
+			// Clocks spring forward on 2024-03-10, the day has 23 hours
+			name:   "daily across DST",
+			period: Daily,
+			now:    time.Date(2024, 3, 10, 12, 0, 0, 0, ny),
+			start:  time.Date(2024, 3, 10, 0, 0, 0, 0, ny),
+			end:    time.Date(2024, 3, 11, 0, 0, 0, 0, ny),
+		},
+		{
+			name:   "weekly starts Monday",
+			period: Weekly,
+			now:    time.Date(2024, 1, 14, 12, 0, 0, 0, ny), // Sunday
+			start:  time.Date(2024, 1, 8, 0, 0, 0, 0, ny),
+			end:    time.Date(2024, 1, 15, 0, 0, 0, 0, ny),
+		},
+		{
+			name:   "monthly end of January",
+			period: Monthly,
+			now:    time.Date(2024, 1, 31, 23, 59, 0, 0, ny),
+			start:  time.Date(2024, 1, 1, 0, 0, 0, 0, ny),
+			end:    time.Date(2024, 2, 1, 0, 0, 0, 0, ny),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.period.bounds(tt.now.In(ny))
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("Expected [%v, %v), got [%v, %v)", tt.start, tt.end, start, end)
+			}
+		})
+	}
+
+	if d := time.Date(2024, 3, 11, 0, 0, 0, 0, ny).Sub(time.Date(2024, 3, 10, 0, 0, 0, 0, ny)); d != 23*time.Hour {
+		t.Errorf("Sanity check: expected 23h day, got %v", d)
+	}
+}
+
+func TestQuota_ClockMovesBackwards(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 2, 0, 30, 0, 0, time.UTC))
+	quota := NewQuota(1, Daily, nil, WithClock(clock))
+
+	quota.Allow("user:alice")
+	clock.Set(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC))
+	used, _, resetsAt := quota.Usage("user:alice")
+	if used != 1 || !resetsAt.Equal(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the current period and usage to be kept, got %d used, reset at %v", used, resetsAt)
+	}
+	if quota.Allow("user:alice") {
+		t.Error("Stepping the clock back should not grant a fresh quota")
+	}
+
+	// Moving forward again within the period keeps the usage too
+	clock.Set(time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC))
+	if used, _, _ := quota.Usage("user:alice"); used != 1 {
+		t.Errorf("Expected usage kept when the clock catches up, got %d", used)
+	}
+	clock.Set(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	if !quota.Allow("user:alice") {
+		t.Error("Next period should start with a fresh quota")
+	}
+}
+
+func TestQuota_WithTokenBucket(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	burst := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	daily := NewQuota(20, Daily, nil, WithClock(clock))
+	monthly := NewQuota(1000, Monthly, nil, WithClock(clock))
+
+	plan, err := NewComposite(
+		Tier{Name: "burst", Limiter: burst},
+		Tier{Name: "daily", Limiter: daily},
+		Tier{Name: "monthly", Limiter: monthly},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := plan.AllowWithTiers("user:alice", 10)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected burst to be exhausted first, got %+v", result.Result)
+	}
+	if result := plan.AllowWithTiers("user:alice", 1); result.DeniedBy != "burst" {
+		t.Errorf("Expected denial by burst, got %q", result.DeniedBy)
+	}
+
+	// The daily quota denies long after the per-second limit recovers
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Second)
+		plan.AllowN("user:alice", 10)
+	}
+	clock.Advance(time.Second)
+	result = plan.AllowWithTiers("user:alice", 1)
+	if result.DeniedBy != "daily" {
+		t.Fatalf("Expected denial by daily quota, got %q", result.DeniedBy)
+	}
+	if want := 12*time.Hour - 3*time.Second; result.RetryAfter != want {
+		t.Errorf("Expected RetryAfter until midnight %v, got %v", want, result.RetryAfter)
+	}
+
+	// The denied request was refunded from the other tiers
+	if used, _, _ := monthly.Usage("user:alice"); used != 20 {
+		t.Errorf("Expected 20 used from the monthly quota, got %d", used)
+	}
+}
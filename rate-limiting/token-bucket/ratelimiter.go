@@ -2,11 +2,72 @@ package tokenbucket
 
 import "time"
 
+// Limiter is the common interface implemented by every rate limiting algorithm
+// in this package. Call sites can depend on Limiter and swap the algorithm
+// (token bucket, GCRA, fixed window, sliding window, leaky bucket, ...) per endpoint.
+//
+// The key identifies WHO is being rate limited (user ID, API key, IP address, etc.)
+// and every key has independent state.
+type Limiter interface {
+	// Allow reports whether a single request for key is allowed
+	Allow(key string) bool
+
+	// AllowN reports whether a request costing n units for key is allowed
+	AllowN(key string, n int) bool
+
+	// AllowWithInfo is like AllowN but returns detailed rate limit information
+	AllowWithInfo(key string, n int) *Result
+
+	// Reset clears the rate limit state for key
+	Reset(key string)
+}
+
+// Refunder is implemented by limiters that can give back consumed capacity
+// Used by Composite to undo tiers when a later tier denies a request.
+type Refunder interface {
+	// Refund returns n units previously consumed by key
+	// Refunding never raises capacity above the limit
+	Refund(key string, n int)
+}
+
+// Compile-time checks that every algorithm satisfies Limiter
+var (
+	_ Limiter = (*TokenBucket)(nil)
+	_ Limiter = (*FixedWindow)(nil)
+	_ Limiter = (*SlidingWindowLog)(nil)
+	_ Limiter = (*SlidingWindowCounter)(nil)
+	_ Limiter = (*LeakyBucket)(nil)
+	_ Limiter = (*GCRA)(nil)
+	_ Limiter = (*ShardedTokenBucket)(nil)
+	_ Limiter = (*StoreTokenBucket)(nil)
+	_ Limiter = (*Composite)(nil)
+	_ Limiter = (*PenaltyLimiter)(nil)
+	_ Limiter = (*Quota)(nil)
+)
+
+// Compile-time checks that every algorithm can be used as a Composite tier
+var (
+	_ Refunder = (*TokenBucket)(nil)
+	_ Refunder = (*ShardedTokenBucket)(nil)
+	_ Refunder = (*GCRA)(nil)
+	_ Refunder = (*FixedWindow)(nil)
+	_ Refunder = (*SlidingWindowLog)(nil)
+	_ Refunder = (*SlidingWindowCounter)(nil)
+	_ Refunder = (*LeakyBucket)(nil)
+	_ Refunder = (*StoreTokenBucket)(nil)
+	_ Refunder = (*Composite)(nil)
+	_ Refunder = (*PenaltyLimiter)(nil)
+	_ Refunder = (*Quota)(nil)
+)
+
 // Result contains information about a rate limit check
 type Result struct {
 	// Allowed indicates if the request is allowed
 	Allowed bool
 
+	// Limit is the capacity for the key: burst size for buckets, requests per window for windows
+	Limit int
+
 	// Remaining is the number of requests remaining in the current window
 	Remaining int
 
@@ -15,4 +76,8 @@ type Result struct {
 
 	// ResetAt is when the rate limit will reset to full capacity
 	ResetAt time.Time
+
+	// Debt is how many tokens the key owes, from a settled overage or an
+	// outstanding reservation. Requests are denied until refill pays it off.
+	Debt int
 }
@@ -6,216 +6,323 @@ import (
 	"time"
 )
 
-func TestTokenBucket_Allow(t *testing.T) {
-	limiter := NewTokenBucket(10, time.Second, 0)
-	key := "user:alice"
+// Shared conformance suite: every test below runs against every Limiter
+// implementation. Algorithm-specific behavior (refill, window rollover)
+// is tested in the algorithm's own test file.
+
+// limiterFactory builds a limiter from token bucket style parameters
+// Window based algorithms use burstSize (defaulting to rate) as their per-window limit
+type limiterFactory func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter
+
+// Arbitrary fixed start time for fake clocks
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var limiterFactories = []struct {
+	name string
+	new  limiterFactory
+}{
+	{"TokenBucket", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewTokenBucket(rate, window, burstSize, opts...)
+	}},
+	{"ShardedTokenBucket", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewShardedTokenBucket(rate, window, burstSize, 8, opts...)
+	}},
+	{"StoreTokenBucket", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewStoreTokenBucket(NewMemoryStore(opts...), rate, window, burstSize, opts...)
+	}},
+	{"GCRA", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewGCRA(rate, window, burstSize, opts...)
+	}},
+	{"FixedWindow", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewFixedWindow(limitFor(rate, burstSize), window, opts...)
+	}},
+	{"SlidingWindowLog", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewSlidingWindowLog(limitFor(rate, burstSize), window, opts...)
+	}},
+	{"SlidingWindowCounter", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewSlidingWindowCounter(limitFor(rate, burstSize), window, opts...)
+	}},
+	{"LeakyBucket", func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+		return NewLeakyBucket(rate, window, burstSize, opts...)
+	}},
+}
 
-	// First 10 requests should succeed (bucket starts full)
-	for i := 0; i < 10; i++ {
-		if !limiter.Allow(key) {
-			t.Errorf("Request %d should be allowed", i+1)
-		}
+func limitFor(rate, burstSize int) int {
+	if burstSize == 0 {
+		return rate
 	}
+	return burstSize
+}
 
-	// 11th request should fail (bucket empty)
-	if limiter.Allow(key) {
-		t.Error("Request 11 should be denied - bucket is empty")
+// forEachLimiter runs test as a subtest for every algorithm
+// Limiters run on a fake clock that never moves, so results are exact
+func forEachLimiter(t *testing.T, test func(t *testing.T, newLimiter limiterFactory)) {
+	for _, f := range limiterFactories {
+		t.Run(f.name, func(t *testing.T) {
+			clock := NewFakeClock(epoch)
+			test(t, func(rate int, window time.Duration, burstSize int, opts ...Option) Limiter {
+				return f.new(rate, window, burstSize, append([]Option{WithClock(clock)}, opts...)...)
+			})
+		})
 	}
 }
 
-func TestTokenBucket_AllowN(t *testing.T) {
-	limiter := NewTokenBucket(100, time.Minute, 100)
-	key := "user:bob"
+func TestLimiter_Allow(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(10, time.Second, 0)
+		key := "user:alice"
 
-	// Single request (1 token)
-	if !limiter.AllowN(key, 1) {
-		t.Error("Single request should be allowed")
-	}
+		// First 10 requests should succeed (bucket starts full)
+		for i := 0; i < 10; i++ {
+			if !limiter.Allow(key) {
+				t.Errorf("Request %d should be allowed", i+1)
+			}
+		}
 
-	// Batch operation (10 tokens)
-	if !limiter.AllowN(key, 10) {
-		t.Error("Batch request (10 tokens) should be allowed")
-	}
+		// 11th request should fail (bucket empty)
+		if limiter.Allow(key) {
+			t.Error("Request 11 should be denied - bucket is empty")
+		}
+	})
+}
 
-	// Expensive operation (50 tokens)
-	if !limiter.AllowN(key, 50) {
-		t.Error("Expensive request (50 tokens) should be allowed")
-	}
+func TestLimiter_AllowN(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(100, time.Minute, 100)
+		key := "user:bob"
 
-	// Check remaining: started with 100, used 1 + 10 + 50 = 61, should have 39 left
-	// Another expensive operation should fail
-	if limiter.AllowN(key, 50) {
-		t.Error("Second expensive request should be denied (only ~39 tokens remaining)")
-	}
-}
+		// Single request (1 token)
+		if !limiter.AllowN(key, 1) {
+			t.Error("Single request should be allowed")
+		}
 
-func TestTokenBucket_ExceedsCapacity(t *testing.T) {
-	limiter := NewTokenBucket(10, time.Second, 10)
-	key := "user:charlie"
+		// Batch operation (10 tokens)
+		if !limiter.AllowN(key, 10) {
+			t.Error("Batch request (10 tokens) should be allowed")
+		}
 
-	// Request more than bucket capacity
-	if limiter.AllowN(key, 20) {
-		t.Error("Request exceeding bucket capacity should be denied")
-	}
+		// Expensive operation (50 tokens)
+		if !limiter.AllowN(key, 50) {
+			t.Error("Expensive request (50 tokens) should be allowed")
+		}
 
-	// Bucket should still be full for normal requests
-	if !limiter.Allow(key) {
-		t.Error("Normal request should still be allowed")
-	}
+		// Check remaining: started with 100, used 1 + 10 + 50 = 61, should have 39 left
+		// Another expensive operation should fail
+		if limiter.AllowN(key, 50) {
+			t.Error("Second expensive request should be denied (only ~39 tokens remaining)")
+		}
+	})
 }
 
-func TestTokenBucket_Refill(t *testing.T) {
-	// 10 tokens/second
-	limiter := NewTokenBucket(10, time.Second, 10)
-	key := "user:david"
+func TestLimiter_ExceedsCapacity(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(10, time.Second, 10)
+		key := "user:charlie"
 
-	// Drain the bucket
-	for i := 0; i < 10; i++ {
-		limiter.Allow(key)
-	}
+		// Request more than bucket capacity
+		if limiter.AllowN(key, 20) {
+			t.Error("Request exceeding bucket capacity should be denied")
+		}
 
-	// Should be denied now
-	if limiter.Allow(key) {
-		t.Error("Should be denied after draining bucket")
-	}
+		// Bucket should still be full for normal requests
+		if !limiter.Allow(key) {
+			t.Error("Normal request should still be allowed")
+		}
+	})
+}
 
-	// Wait 500ms (should refill ~5 tokens)
-	time.Sleep(500 * time.Millisecond)
+func TestLimiter_IndependentKeys(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(5, time.Second, 5)
 
-	// Should be able to make a few more requests
-	allowed := 0
-	for i := 0; i < 10; i++ {
-		if limiter.Allow(key) {
-			allowed++
+		// Drain Alice's bucket
+		for i := 0; i < 5; i++ {
+			limiter.Allow("user:alice")
 		}
-	}
 
-	// Should have gotten approximately 5 tokens back (±1 for timing variance)
-	if allowed < 4 || allowed > 6 {
-		t.Errorf("Expected ~5 tokens after 500ms, got %d", allowed)
-	}
+		// Alice should be denied
+		if limiter.Allow("user:alice") {
+			t.Error("Alice should be rate limited")
+		}
+
+		// Bob should still have full bucket (independent keys)
+		if !limiter.Allow("user:bob") {
+			t.Error("Bob should not be affected by Alice's rate limit")
+		}
+	})
 }
 
-func TestTokenBucket_IndependentKeys(t *testing.T) {
-	limiter := NewTokenBucket(5, time.Second, 5)
+func TestLimiter_AllowWithInfo(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(10, time.Second, 15)
+		key := "user:eve"
 
-	// Drain Alice's bucket
-	for i := 0; i < 5; i++ {
-		limiter.Allow("user:alice")
-	}
+		// First request
+		result := limiter.AllowWithInfo(key, 1)
+		if !result.Allowed {
+			t.Error("First request should be allowed")
+		}
+		if result.Remaining != 14 {
+			t.Errorf("Expected 14 remaining tokens, got %d", result.Remaining)
+		}
+		if result.Limit != 15 {
+			t.Errorf("Expected limit of 15, got %d", result.Limit)
+		}
 
-	// Alice should be denied
-	if limiter.Allow("user:alice") {
-		t.Error("Alice should be rate limited")
-	}
+		// Drain the bucket
+		for limiter.Allow(key) {
+			// Keep draining
+		}
 
-	// Bob should still have full bucket (independent keys)
-	if !limiter.Allow("user:bob") {
-		t.Error("Bob should not be affected by Alice's rate limit")
-	}
+		// Check denied result
+		result = limiter.AllowWithInfo(key, 1)
+		if result.Allowed {
+			t.Error("Request should be denied when bucket is empty")
+		}
+		if result.Remaining != 0 {
+			t.Errorf("Expected 0 remaining tokens, got %d", result.Remaining)
+		}
+		if result.RetryAfter == 0 {
+			t.Error("RetryAfter should be set when denied")
+		}
+		if result.ResetAt.IsZero() {
+			t.Error("ResetAt should be set")
+		}
+	})
 }
 
-func TestTokenBucket_AllowWithInfo(t *testing.T) {
-	limiter := NewTokenBucket(10, time.Second, 15)
-	key := "user:eve"
-
-	// First request
-	result := limiter.AllowWithInfo(key, 1)
-	if !result.Allowed {
-		t.Error("First request should be allowed")
-	}
-	if result.Remaining != 14 {
-		t.Errorf("Expected 14 remaining tokens, got %d", result.Remaining)
-	}
+func TestLimiter_Burst(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		// Rate: 5/sec, Burst: 10 (allows temporary spike)
+		limiter := newLimiter(5, time.Second, 10)
+		key := "user:frank"
 
-	// Drain the bucket
-	for limiter.Allow(key) {
-		// Keep draining
-	}
+		// Should handle burst of 10
+		for i := 0; i < 10; i++ {
+			if !limiter.Allow(key) {
+				t.Errorf("Burst request %d should be allowed (burst capacity = 10)", i+1)
+			}
+		}
 
-	// Check denied result
-	result = limiter.AllowWithInfo(key, 1)
-	if result.Allowed {
-		t.Error("Request should be denied when bucket is empty")
-	}
-	if result.Remaining != 0 {
-		t.Errorf("Expected 0 remaining tokens, got %d", result.Remaining)
-	}
-	if result.RetryAfter == 0 {
-		t.Error("RetryAfter should be set when denied")
-	}
-	if result.ResetAt.IsZero() {
-		t.Error("ResetAt should be set")
-	}
+		// 11th should fail
+		if limiter.Allow(key) {
+			t.Error("Request beyond burst capacity should be denied")
+		}
+	})
 }
 
-func TestTokenBucket_Burst(t *testing.T) {
-	// Rate: 5/sec, Burst: 10 (allows temporary spike)
-	limiter := NewTokenBucket(5, time.Second, 10)
-	key := "user:frank"
+func TestLimiter_Reset(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(5, time.Second, 5)
+		key := "user:grace"
 
-	// Should handle burst of 10
-	for i := 0; i < 10; i++ {
+		// Drain bucket
+		for i := 0; i < 5; i++ {
+			limiter.Allow(key)
+		}
+
+		// Should be denied
+		if limiter.Allow(key) {
+			t.Error("Should be denied after draining")
+		}
+
+		// Reset
+		limiter.Reset(key)
+
+		// Should have full bucket again
 		if !limiter.Allow(key) {
-			t.Errorf("Burst request %d should be allowed (burst capacity = 10)", i+1)
+			t.Error("Should be allowed after reset")
 		}
-	}
+	})
+}
 
-	// 11th should fail
-	if limiter.Allow(key) {
-		t.Error("Request beyond burst capacity should be denied")
-	}
+func TestLimiter_ConcurrentAccess(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(100, time.Second, 100)
+		key := "user:concurrent"
+
+		var wg sync.WaitGroup
+		allowedCount := 0
+		var mu sync.Mutex
+
+		// Launch 150 concurrent requests (more than capacity)
+		for i := 0; i < 150; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if limiter.Allow(key) {
+					mu.Lock()
+					allowedCount++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		// Should have allowed exactly 100 (bucket capacity)
+		if allowedCount != 100 {
+			t.Errorf("Expected exactly 100 allowed requests, got %d", allowedCount)
+		}
+	})
 }
 
-func TestTokenBucket_Reset(t *testing.T) {
-	limiter := NewTokenBucket(5, time.Second, 5)
-	key := "user:grace"
+func TestLimiter_Refund(t *testing.T) {
+	forEachLimiter(t, func(t *testing.T, newLimiter limiterFactory) {
+		limiter := newLimiter(10, time.Second, 10)
+		key := "user:ivan"
+
+		limiter.AllowN(key, 10)
+		limiter.(Refunder).Refund(key, 3)
+
+		// Exactly the refunded capacity is available again
+		if !limiter.AllowN(key, 3) {
+			t.Error("Refunded capacity should be available")
+		}
+		if limiter.Allow(key) {
+			t.Error("Refund should only return what was refunded")
+		}
+
+		// Refunding never exceeds the limit
+		other := "user:judy"
+		limiter.Allow(other)
+		limiter.(Refunder).Refund(other, 100)
+		if result := limiter.AllowWithInfo(other, 0); result.Remaining != 10 {
+			t.Errorf("Expected refund capped at 10 remaining, got %d", result.Remaining)
+		}
+	})
+}
+
+func TestTokenBucket_Refill(t *testing.T) {
+	// 10 tokens/second
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	key := "user:david"
 
-	// Drain bucket
-	for i := 0; i < 5; i++ {
+	// Drain the bucket
+	for i := 0; i < 10; i++ {
 		limiter.Allow(key)
 	}
 
-	// Should be denied
+	// Should be denied now
 	if limiter.Allow(key) {
-		t.Error("Should be denied after draining")
+		t.Error("Should be denied after draining bucket")
 	}
 
-	// Reset
-	limiter.Reset(key)
+	// Advance 500ms (should refill exactly 5 tokens)
+	clock.Advance(500 * time.Millisecond)
 
-	// Should have full bucket again
-	if !limiter.Allow(key) {
-		t.Error("Should be allowed after reset")
-	}
-}
-
-func TestTokenBucket_ConcurrentAccess(t *testing.T) {
-	limiter := NewTokenBucket(100, time.Second, 100)
-	key := "user:concurrent"
-
-	var wg sync.WaitGroup
-	allowedCount := 0
-	var mu sync.Mutex
-
-	// Launch 150 concurrent requests (more than capacity)
-	for i := 0; i < 150; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if limiter.Allow(key) {
-				mu.Lock()
-				allowedCount++
-				mu.Unlock()
-			}
-		}()
+	// Should be able to make a few more requests
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow(key) {
+			allowed++
+		}
 	}
 
-	wg.Wait()
-
-	// Should have allowed exactly 100 (bucket capacity)
-	if allowedCount != 100 {
-		t.Errorf("Expected exactly 100 allowed requests, got %d", allowedCount)
+	// Should have gotten exactly 5 tokens back
+	if allowed != 5 {
+		t.Errorf("Expected 5 tokens after 500ms, got %d", allowed)
 	}
 }
 
@@ -0,0 +1,143 @@
+package tokenbucket
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrExceedsBurst is returned when a request needs more tokens than the bucket can ever hold
+var ErrExceedsBurst = errors.New("tokenbucket: requested tokens exceed burst size")
+
+// Reservation holds tokens taken from a TokenBucket ahead of time
+// The tokens are consumed immediately (the balance may go negative) and the
+// caller must wait Delay() before acting on them. Later callers see the
+// negative balance, so reservations are served in order instead of racing.
+type Reservation struct {
+	tb        *TokenBucket
+	key       string
+	tokens    int
+	ok        bool
+	timeToAct time.Time
+	canceled  bool // Guarded by tb.mu
+}
+
+// Reserve takes n tokens for key and returns a reservation saying when they may be used
+// If n exceeds the burst size the reservation is not OK and consumes nothing
+func (tb *TokenBucket) Reserve(key string, n int) *Reservation {
+	r, result := tb.reserve(key, n)
+	if tb.observer != nil {
+		tb.observer.Observe(key, n, result)
+	}
+	return r
+}
+
+func (tb *TokenBucket) reserve(key string, n int) (*Reservation, *Result) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.clock.Now()
+	r := &Reservation{tb: tb, key: key, tokens: n, timeToAct: now}
+	b, p, exists := tb.refill(key, now)
+	if n > p.BurstSize {
+		return r, tb.buildResult(b, p, false, n, now)
+	}
+
+	b.tokens -= float64(n)
+	if !exists {
+		tb.insert(key, b)
+	}
+
+	// If the balance went negative, wait until refill pays off the debt
+	if b.tokens < 0 {
+		wait := -b.tokens * float64(time.Second) / p.refillRate()
+		r.timeToAct = now.Add(time.Duration(wait))
+	}
+	r.ok = true
+	return r, tb.buildResult(b, p, true, 0, now)
+}
+
+// OK reports whether the reservation holds tokens
+// A reservation is not OK when n exceeds the burst size
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long the caller must wait before using the reserved tokens
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(r.tb.clock.Now())
+}
+
+// DelayFrom returns how long after now the reserved tokens may be used
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return 0
+	}
+	delay := r.timeToAct.Sub(now)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Cancel gives the reserved tokens back to the bucket
+// Only has an effect if the reservation has not come due yet, since after that
+// the tokens are assumed to have been used. Calling Cancel twice is safe.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	tb := r.tb
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.clock.Now()
+	if r.canceled || !now.Before(r.timeToAct) {
+		return
+	}
+	r.canceled = true
+
+	b, p, exists := tb.refill(r.key, now)
+	if !exists {
+		// Key was reset in the meantime, nothing to give back
+		return
+	}
+	b.tokens = math.Min(b.tokens+float64(r.tokens), float64(p.BurstSize))
+}
+
+// Wait blocks until n tokens are available for key or ctx is done
+// Returns ErrExceedsBurst if n can never be satisfied. If ctx is cancelled
+// (or its deadline would pass before the tokens are available) the
+// reservation is cancelled and the context error is returned.
+func (tb *TokenBucket) Wait(ctx context.Context, key string, n int) error {
+	// Don't take tokens for a context that is already done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r := tb.Reserve(key, n)
+	if !r.OK() {
+		return ErrExceedsBurst
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.timeToAct) {
+		// No point in waiting: the context expires first
+		r.Cancel()
+		return context.DeadlineExceeded
+	}
+
+	timer := tb.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,173 @@
+package tokenbucket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_ReserveDelay(t *testing.T) {
+	// One token every 100ms
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	key := "user:alice"
+
+	r := limiter.Reserve(key, 10)
+	if !r.OK() || r.Delay() != 0 {
+		t.Fatalf("Full bucket should reserve immediately, got ok=%v delay=%v", r.OK(), r.Delay())
+	}
+
+	// Bucket is empty: 5 more tokens take 500ms
+	r = limiter.Reserve(key, 5)
+	if !r.OK() {
+		t.Fatal("Reservation within burst size should be OK")
+	}
+	if d := r.Delay(); d != 500*time.Millisecond {
+		t.Errorf("Expected delay 500ms, got %v", d)
+	}
+
+	// Reservations queue up behind each other
+	r = limiter.Reserve(key, 1)
+	if d := r.Delay(); d != 600*time.Millisecond {
+		t.Errorf("Expected delay 600ms behind previous reservation, got %v", d)
+	}
+
+	// Outstanding reservations show up as no remaining tokens
+	result := limiter.AllowWithInfo(key, 1)
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected denial with 0 remaining, got %v/%d", result.Allowed, result.Remaining)
+	}
+	if result.RetryAfter != 700*time.Millisecond {
+		t.Errorf("Expected RetryAfter 700ms, got %v", result.RetryAfter)
+	}
+
+	// Delay counts down with the clock
+	clock.Advance(250 * time.Millisecond)
+	if d := r.Delay(); d != 350*time.Millisecond {
+		t.Errorf("Expected delay 350ms after advancing, got %v", d)
+	}
+}
+
+func TestTokenBucket_ReserveExceedsBurst(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(NewFakeClock(epoch)))
+
+	r := limiter.Reserve("user:bob", 11)
+	if r.OK() {
+		t.Error("Reservation larger than burst should not be OK")
+	}
+	if !limiter.AllowN("user:bob", 10) {
+		t.Error("Failed reservation should not consume tokens")
+	}
+}
+
+func TestTokenBucket_ReserveCancel(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(NewFakeClock(epoch)))
+	key := "user:charlie"
+
+	limiter.AllowN(key, 8)
+	r := limiter.Reserve(key, 5) // 2 available, 3 owed
+	r.Cancel()
+	r.Cancel() // Second cancel must not refund twice
+
+	if !limiter.AllowN(key, 2) {
+		t.Error("Cancelled tokens should be back in the bucket")
+	}
+	if limiter.Allow(key) {
+		t.Error("Cancel should only refund the reserved tokens")
+	}
+}
+
+func TestTokenBucket_ReserveCancelAfterDue(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(NewFakeClock(epoch)))
+	key := "user:david"
+
+	r := limiter.Reserve(key, 10)
+	// Due immediately -> tokens count as used, cancel is a no-op
+	r.Cancel()
+	if limiter.Allow(key) {
+		t.Error("Cancelling a due reservation should not refund tokens")
+	}
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(20, time.Second, 1, WithClock(clock))
+	key := "user:eve"
+
+	// First token is free
+	if err := limiter.Wait(context.Background(), key, 1); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	// Second one has to wait 50ms for the refill
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(context.Background(), key, 1)
+	}()
+	clock.BlockUntil(1)
+
+	clock.Advance(49 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Wait returned before the token was available")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	if err := <-done; err != nil {
+		t.Errorf("Wait failed: %v", err)
+	}
+}
+
+func TestTokenBucket_WaitContextCancelled(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	key := "user:frank"
+	limiter.AllowN(key, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(ctx, key, 5)
+	}()
+	clock.BlockUntil(1)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	// The cancelled wait gave back its tokens: after 100ms one token is available,
+	// which would not be the case if 5 tokens were still owed
+	clock.Advance(100 * time.Millisecond)
+	if !limiter.Allow(key) {
+		t.Error("Cancelled Wait should return its reserved tokens")
+	}
+}
+
+func TestTokenBucket_WaitDeadlineTooShort(t *testing.T) {
+	limiter := NewTokenBucket(1, time.Second, 1)
+	key := "user:grace"
+	limiter.Allow(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Fails immediately instead of sleeping until the deadline
+	err := limiter.Wait(ctx, key, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("Wait should fail fast when the deadline is before the reservation")
+	}
+}
+
+func TestTokenBucket_WaitExceedsBurst(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10)
+
+	if err := limiter.Wait(context.Background(), "user:heidi", 11); !errors.Is(err, ErrExceedsBurst) {
+		t.Errorf("Expected ErrExceedsBurst, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package tokenbucket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrTicketSettled is returned when a ticket is settled twice
+	ErrTicketSettled = errors.New("tokenbucket: ticket already settled")
+
+	// ErrTicketExpired is returned when a ticket is settled after its TTL
+	// The ticket was auto-settled at its estimate.
+	ErrTicketExpired = errors.New("tokenbucket: ticket expired")
+
+	// ErrForeignTicket is returned when a ticket is settled on a limiter
+	// other than the one that issued it
+	ErrForeignTicket = errors.New("tokenbucket: ticket from another limiter")
+)
+
+// Default time a ticket may stay open before it auto-settles at its estimate
+const defaultTicketTTL = time.Minute
+
+// Ticket holds the tokens taken for a request whose real cost is only known
+// after it runs, e.g. a log range scan. Settle it with the actual cost.
+type Ticket struct {
+	tb        *TokenBucket
+	key       string
+	estimate  int
+	expiresAt time.Time
+	settled   bool // Guarded by tb.mu
+}
+
+// Estimate returns the number of tokens taken when the ticket was acquired
+func (t *Ticket) Estimate() int {
+	return t.estimate
+}
+
+// ExpiresAt returns when the ticket auto-settles at its estimate
+func (t *Ticket) ExpiresAt() time.Time {
+	return t.expiresAt
+}
+
+// Acquire takes estimate tokens for key and returns a ticket to settle later
+// The ticket is nil when the request is denied; the Result says why and for how long.
+func (tb *TokenBucket) Acquire(key string, estimate int) (*Ticket, *Result) {
+	result := tb.AllowWithInfo(key, estimate)
+	if !result.Allowed {
+		return nil, result
+	}
+	return &Ticket{
+		tb:        tb,
+		key:       key,
+		estimate:  estimate,
+		expiresAt: tb.clock.Now().Add(tb.ticketTTL),
+	}, result
+}
+
+// Settle charges the actual cost of a ticket's request
+// Unused tokens are refunded, up to the burst size. An overage is charged even
+// if it drives the balance negative: the key is then in debt and its requests
+// are denied until refill pays it off (see Result.Debt).
+//
+// A ticket settles once. After its TTL it has already been settled at the
+// estimate and ErrTicketExpired is returned without charging anything.
+// Tickets must be settled on the limiter that issued them.
+func (tb *TokenBucket) Settle(t *Ticket, actual int) (*Result, error) {
+	if actual < 0 {
+		return nil, fmt.Errorf("tokenbucket: negative cost %d", actual)
+	}
+	// The ticket's state is guarded by its own limiter's lock, not ours
+	if t == nil || t.tb != tb {
+		return nil, ErrForeignTicket
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if t.settled {
+		return nil, ErrTicketSettled
+	}
+	t.settled = true
+
+	now := tb.clock.Now()
+	if !now.Before(t.expiresAt) {
+		return nil, ErrTicketExpired
+	}
+
+	b, p, exists := tb.refill(t.key, now)
+	b.tokens = min(b.tokens+float64(t.estimate-actual), float64(p.BurstSize))
+	if !exists {
+		tb.insert(t.key, b)
+	}
+	return tb.buildResult(b, p, true, 0, now), nil
+}
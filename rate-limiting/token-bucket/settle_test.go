@@ -0,0 +1,187 @@
+package tokenbucket
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_SettleRefundsUnused(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	key := "user:alice"
+
+	ticket, result := limiter.Acquire(key, 8)
+	if ticket == nil || !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("Expected ticket with 2 remaining, got %v/%+v", ticket, result)
+	}
+
+	// The scan was cheaper than feared: 5 of the 8 tokens come back
+	result, err := limiter.Settle(ticket, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Remaining != 7 || result.Debt != 0 {
+		t.Errorf("Expected 7 remaining and no debt, got %+v", result)
+	}
+
+	// Refunds never overfill the bucket
+	ticket, _ = limiter.Acquire(key, 1)
+	clock.Advance(time.Second)
+	if result, _ := limiter.Settle(ticket, 0); result.Remaining != 10 {
+		t.Errorf("Expected refund capped at burst 10, got %d", result.Remaining)
+	}
+}
+
+func TestTokenBucket_SettleOverageCreatesDebt(t *testing.T) {
+	// One token every 100ms
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	key := "user:alice"
+
+	ticket, _ := limiter.Acquire(key, 5)
+	result, err := limiter.Settle(ticket, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Debt != 15 || result.Remaining != 0 {
+		t.Fatalf("Expected debt of 15, got %+v", result)
+	}
+
+	// Denied until refill pays off the debt and earns a token
+	result = limiter.AllowWithInfo(key, 1)
+	if result.Allowed || result.Debt != 15 {
+		t.Errorf("Expected denial while in debt, got %+v", result)
+	}
+	if result.RetryAfter != 1600*time.Millisecond {
+		t.Errorf("Expected RetryAfter 1.6s, got %v", result.RetryAfter)
+	}
+
+	clock.Advance(time.Second)
+	if result := limiter.AllowWithInfo(key, 1); result.Allowed || result.Debt != 5 {
+		t.Errorf("Expected debt of 5 after 1s, got %+v", result)
+	}
+	clock.Advance(600 * time.Millisecond)
+	if result := limiter.AllowWithInfo(key, 1); !result.Allowed || result.Debt != 0 {
+		t.Errorf("Expected allowed once the debt is paid, got %+v", result)
+	}
+}
+
+func TestTokenBucket_AcquireDenied(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+
+	if ticket, result := limiter.Acquire("k", 11); ticket != nil || result.Allowed {
+		t.Error("Estimate above the burst size should be denied")
+	}
+	limiter.AllowN("k", 8)
+	ticket, result := limiter.Acquire("k", 5)
+	if ticket != nil || result.Allowed || result.RetryAfter != 300*time.Millisecond {
+		t.Errorf("Expected denial with RetryAfter 300ms, got %v/%+v", ticket, result)
+	}
+}
+
+func TestTokenBucket_SettleTwice(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(NewFakeClock(epoch)))
+	ticket, _ := limiter.Acquire("k", 5)
+	if _, err := limiter.Settle(ticket, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.Settle(ticket, 1); !errors.Is(err, ErrTicketSettled) {
+		t.Errorf("Expected ErrTicketSettled, got %v", err)
+	}
+	if _, err := limiter.Settle(ticket, -1); err == nil {
+		t.Error("Expected an error for a negative cost")
+	}
+}
+
+func TestTokenBucket_SettleForeignTicket(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	issuer := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	other := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+
+	ticket, _ := issuer.Acquire("user:alice", 8)
+	if _, err := other.Settle(ticket, 0); !errors.Is(err, ErrForeignTicket) {
+		t.Errorf("Expected ErrForeignTicket, got %v", err)
+	}
+	if _, err := other.Settle(nil, 0); !errors.Is(err, ErrForeignTicket) {
+		t.Errorf("Expected ErrForeignTicket for a nil ticket, got %v", err)
+	}
+	if stats := other.Stats(); stats.Keys != 0 {
+		t.Error("Foreign ticket should not touch the other limiter's buckets")
+	}
+
+	// The ticket is still open on its own limiter
+	result, err := issuer.Settle(ticket, 0)
+	if err != nil || result.Remaining != 10 {
+		t.Errorf("Expected the issuer to settle the ticket, got %+v, %v", result, err)
+	}
+}
+
+func TestTokenBucket_TicketExpiresAtEstimate(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(1, time.Second, 10, WithClock(clock), WithTicketTTL(5*time.Second))
+
+	ticket, _ := limiter.Acquire("k", 10)
+	if want := epoch.Add(5 * time.Second); !ticket.ExpiresAt().Equal(want) || ticket.Estimate() != 10 {
+		t.Errorf("Ticket = %v/%d, want expiry %v estimate 10", ticket.ExpiresAt(), ticket.Estimate(), want)
+	}
+
+	clock.Advance(5 * time.Second)
+	if _, err := limiter.Settle(ticket, 100); !errors.Is(err, ErrTicketExpired) {
+		t.Fatalf("Expected ErrTicketExpired, got %v", err)
+	}
+	// The estimate stands: 5 tokens refilled, no overage charged
+	if result := limiter.AllowWithInfo("k", 0); result.Remaining != 5 || result.Debt != 0 {
+		t.Errorf("Expected 5 remaining and no debt, got %+v", result)
+	}
+}
+
+func TestShardedTokenBucket_AcquireSettle(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 4, WithClock(clock))
+
+	ticket, _ := limiter.Acquire("k", 2)
+	result, err := limiter.Settle(ticket, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Debt != 2 {
+		t.Errorf("Expected debt of 2, got %+v", result)
+	}
+}
+
+func TestShardedTokenBucket_SettleForeignTicket(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 4, WithClock(clock))
+	other := NewShardedTokenBucket(10, time.Second, 10, 4, WithClock(clock))
+	plain := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+
+	if _, err := limiter.Settle(nil, 0); !errors.Is(err, ErrForeignTicket) {
+		t.Errorf("Expected ErrForeignTicket for a nil ticket, got %v", err)
+	}
+	ticket, _ := plain.Acquire("k", 5)
+	if _, err := limiter.Settle(ticket, 0); !errors.Is(err, ErrForeignTicket) {
+		t.Errorf("Expected ErrForeignTicket for a TokenBucket's ticket, got %v", err)
+	}
+	ticket, _ = other.Acquire("k", 5)
+	if _, err := limiter.Settle(ticket, 0); !errors.Is(err, ErrForeignTicket) {
+		t.Errorf("Expected ErrForeignTicket for another sharded limiter's ticket, got %v", err)
+	}
+	if _, err := other.Settle(ticket, 0); err != nil {
+		t.Errorf("Expected the issuer to settle its ticket, got %v", err)
+	}
+}
+
+func TestComposite_ReportsDebt(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	user := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	global := NewTokenBucket(100, time.Second, 100, WithClock(clock))
+	c, _ := NewComposite(Tier{Name: "user", Limiter: user}, Tier{Name: "global", Limiter: global, Key: FixedKey("global")})
+
+	ticket, _ := user.Acquire("alice", 1)
+	user.Settle(ticket, 14)
+	if result := c.AllowWithInfo("alice", 1); result.Allowed || result.Debt != 4 {
+		t.Errorf("Expected denial with debt 4, got %+v", result)
+	}
+}
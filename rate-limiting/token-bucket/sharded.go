@@ -0,0 +1,263 @@
+package tokenbucket
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ShardedTokenBucket is a TokenBucket split into independently locked shards
+// Every key is hashed to one shard, so requests for different keys rarely
+// contend on the same mutex. Per-key semantics are identical to TokenBucket
+// because all state for a key lives in exactly one shard.
+//
+// Use it on hot paths with many goroutines and many keys. With a single hot
+// key all traffic still lands on one shard and it behaves like TokenBucket.
+type ShardedTokenBucket struct {
+	shards []*TokenBucket
+	clock  Clock
+
+	// Periodic snapshots of all shards into one file, see snapshot.go
+	snapshotPath string
+	mu           sync.Mutex // Guards snapshotErr
+	snapshotErr  error
+	stop         chan struct{}
+	background   sync.WaitGroup
+	closeOnce    sync.Once
+}
+
+// NewShardedTokenBucket creates a sharded token bucket rate limiter
+// shards <= 0 picks a default based on GOMAXPROCS. A WithMaxKeys cap is split
+// evenly across the shards, so LRU eviction is approximate across the whole limiter.
+// WithSnapshotFile snapshots all shards together into a single file.
+func NewShardedTokenBucket(rate int, window time.Duration, burstSize int, shards int, opts ...Option) *ShardedTokenBucket {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+
+	o := buildOptions(opts)
+	// Shards must not each write their part over the same snapshot file
+	shardOpts := append(append([]Option{}, opts...), WithSnapshotFile("", 0))
+	if o.maxKeys > 0 {
+		// Round up so the total cap is never below what was asked for
+		perShard := (o.maxKeys + shards - 1) / shards
+		shardOpts = append(shardOpts, WithMaxKeys(perShard))
+	}
+
+	s := &ShardedTokenBucket{shards: make([]*TokenBucket, shards), clock: o.clock}
+	for i := range s.shards {
+		s.shards[i] = NewTokenBucket(rate, window, burstSize, shardOpts...)
+	}
+	s.startSnapshots(o)
+	return s
+}
+
+// Pick the shard for a key using FNV-1a
+// Hashes the string in place to avoid the allocation of hash/fnv
+func (s *ShardedTokenBucket) shard(key string) *TokenBucket {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (s *ShardedTokenBucket) Allow(key string) bool {
+	return s.shard(key).AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (s *ShardedTokenBucket) AllowN(key string, n int) bool {
+	return s.shard(key).AllowN(key, n)
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+func (s *ShardedTokenBucket) AllowWithInfo(key string, n int) *Result {
+	return s.shard(key).AllowWithInfo(key, n)
+}
+
+// Reset clears the rate limit state for a key
+func (s *ShardedTokenBucket) Reset(key string) {
+	s.shard(key).Reset(key)
+}
+
+// Refund returns n tokens to the bucket for key
+func (s *ShardedTokenBucket) Refund(key string, n int) {
+	s.shard(key).Refund(key, n)
+}
+
+// Reserve takes n tokens for key, see TokenBucket.Reserve
+func (s *ShardedTokenBucket) Reserve(key string, n int) *Reservation {
+	return s.shard(key).Reserve(key, n)
+}
+
+// Wait blocks until n tokens are available for key, see TokenBucket.Wait
+func (s *ShardedTokenBucket) Wait(ctx context.Context, key string, n int) error {
+	return s.shard(key).Wait(ctx, key, n)
+}
+
+// Acquire takes estimate tokens for key, see TokenBucket.Acquire
+func (s *ShardedTokenBucket) Acquire(key string, estimate int) (*Ticket, *Result) {
+	return s.shard(key).Acquire(key, estimate)
+}
+
+// Settle charges the actual cost of a ticket, see TokenBucket.Settle
+func (s *ShardedTokenBucket) Settle(t *Ticket, actual int) (*Result, error) {
+	if t == nil || t.tb != s.shard(t.key) {
+		return nil, ErrForeignTicket
+	}
+	return t.tb.Settle(t, actual)
+}
+
+// Stats returns counts of live and evicted keys summed over all shards
+func (s *ShardedTokenBucket) Stats() Stats {
+	var total Stats
+	for _, shard := range s.shards {
+		stats := shard.Stats()
+		total.Keys += stats.Keys
+		total.Evicted += stats.Evicted
+	}
+	return total
+}
+
+// Close stops the janitors of all shards and the snapshotter, if any
+// With WithSnapshotFile a final snapshot is written and its error returned.
+func (s *ShardedTokenBucket) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+		s.background.Wait()
+		for _, shard := range s.shards {
+			shard.Close()
+		}
+		if s.snapshotPath != "" {
+			err = s.SnapshotFile(s.snapshotPath)
+		}
+	})
+	return err
+}
+
+// Snapshot writes the state of every bucket in all shards to w
+// The format is the one of TokenBucket.Snapshot, so a snapshot can be
+// restored into a limiter with a different number of shards, or none.
+func (s *ShardedTokenBucket) Snapshot(w io.Writer) error {
+	var entries []snapshotEntry
+	for _, shard := range s.shards {
+		entries = append(entries, shard.snapshotEntries()...)
+	}
+	return writeSnapshot(w, entries)
+}
+
+// Restore loads bucket state written by Snapshot, see TokenBucket.Restore
+// Every key goes to the shard it hashes to now.
+func (s *ShardedTokenBucket) Restore(r io.Reader) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	byShard := make(map[*TokenBucket][]snapshotEntry)
+	for _, e := range entries {
+		shard := s.shard(e.key)
+		byShard[shard] = append(byShard[shard], e)
+	}
+	for shard, entries := range byShard {
+		shard.restoreEntries(entries)
+	}
+	return nil
+}
+
+// SnapshotFile writes a snapshot of all shards to path atomically
+func (s *ShardedTokenBucket) SnapshotFile(path string) error {
+	return writeFileAtomic(path, s.Snapshot)
+}
+
+// RestoreFile restores a snapshot written by SnapshotFile
+func (s *ShardedTokenBucket) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Restore(f)
+}
+
+// SnapshotErr returns the error of the last periodic snapshot, nil if it succeeded
+func (s *ShardedTokenBucket) SnapshotErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotErr
+}
+
+// Start the periodic snapshotter based on options
+func (s *ShardedTokenBucket) startSnapshots(o options) {
+	if o.snapshotPath == "" {
+		return
+	}
+	s.snapshotPath = o.snapshotPath
+	if o.snapshotInterval > 0 {
+		s.stop = make(chan struct{})
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			snapshotEvery(s.clock, o.snapshotInterval, s.stop, func() {
+				err := s.SnapshotFile(s.snapshotPath)
+				s.mu.Lock()
+				s.snapshotErr = err
+				s.mu.Unlock()
+			})
+		}()
+	}
+}
+
+// SetPolicy sets an override on every shard, see TokenBucket.SetPolicy
+func (s *ShardedTokenBucket) SetPolicy(pattern string, p Policy) error {
+	for _, shard := range s.shards {
+		if err := shard.SetPolicy(pattern, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemovePolicy removes an override from every shard
+func (s *ShardedTokenBucket) RemovePolicy(pattern string) {
+	for _, shard := range s.shards {
+		shard.RemovePolicy(pattern)
+	}
+}
+
+// SetDefaultPolicy changes the default policy of every shard
+func (s *ShardedTokenBucket) SetDefaultPolicy(p Policy) error {
+	for _, shard := range s.shards {
+		if err := shard.SetDefaultPolicy(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyPolicies replaces the policies of every shard, see TokenBucket.ApplyPolicies
+func (s *ShardedTokenBucket) ApplyPolicies(set *PolicySet) error {
+	for _, shard := range s.shards {
+		if err := shard.ApplyPolicies(set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PolicyFor returns the policy in effect for key
+func (s *ShardedTokenBucket) PolicyFor(key string) Policy {
+	return s.shard(key).PolicyFor(key)
+}
@@ -0,0 +1,107 @@
+package tokenbucket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedTokenBucket_SpreadsKeys(t *testing.T) {
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 16, WithClock(NewFakeClock(epoch)))
+
+	for i := 0; i < 1000; i++ {
+		limiter.Allow(fmt.Sprintf("ip:%d", i))
+	}
+
+	used := 0
+	for _, shard := range limiter.shards {
+		if len(shard.buckets) > 0 {
+			used++
+		}
+	}
+	if used != 16 {
+		t.Errorf("Expected keys on all 16 shards, got %d", used)
+	}
+	if stats := limiter.Stats(); stats.Keys != 1000 {
+		t.Errorf("Expected 1000 keys, got %d", stats.Keys)
+	}
+}
+
+func TestShardedTokenBucket_SameKeySameShard(t *testing.T) {
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 16)
+
+	for _, key := range []string{"user:alice", "user:bob", ""} {
+		if limiter.shard(key) != limiter.shard(key) {
+			t.Errorf("Key %q hashed to different shards", key)
+		}
+	}
+}
+
+func TestShardedTokenBucket_MaxKeysSplitAcrossShards(t *testing.T) {
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 4, WithMaxKeys(100))
+
+	for i := 0; i < 10000; i++ {
+		limiter.Allow(fmt.Sprintf("ip:%d", i))
+	}
+	if stats := limiter.Stats(); stats.Keys > 100 {
+		t.Errorf("Expected at most 100 keys across shards, got %d", stats.Keys)
+	}
+}
+
+func TestShardedTokenBucket_DefaultShards(t *testing.T) {
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 0)
+	if len(limiter.shards) == 0 {
+		t.Error("Default shard count should be positive")
+	}
+}
+
+// Compare the single-mutex TokenBucket to the sharded one under contention
+// e.g. go test -bench=Contention -run=^$ ./rate-limiting/...
+func BenchmarkContention(b *testing.B) {
+	implementations := []struct {
+		name string
+		new  func() Limiter
+	}{
+		{"TokenBucket", func() Limiter {
+			return NewTokenBucket(1000000, time.Second, 1000000)
+		}},
+		{"Sharded", func() Limiter {
+			return NewShardedTokenBucket(1000000, time.Second, 1000000, 0)
+		}},
+	}
+
+	for _, impl := range implementations {
+		for _, keyCount := range []int{4, 100000} {
+			keys := make([]string, keyCount)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("user:%d", i)
+			}
+			for _, goroutines := range []int{1, 8, 64} {
+				name := fmt.Sprintf("%s/keys=%d/goroutines=%d", impl.name, keyCount, goroutines)
+				b.Run(name, func(b *testing.B) {
+					benchmarkGoroutines(b, impl.new(), keys, goroutines)
+				})
+			}
+		}
+	}
+}
+
+// Split b.N calls to Allow across exactly n goroutines
+// (b.RunParallel ties the goroutine count to GOMAXPROCS)
+func benchmarkGoroutines(b *testing.B, limiter Limiter, keys []string, n int) {
+	var wg sync.WaitGroup
+	perGoroutine := b.N / n
+	b.ResetTimer()
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			i := g * perGoroutine
+			for j := 0; j < perGoroutine; j++ {
+				limiter.Allow(keys[(i+j)%len(keys)])
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,264 @@
+package tokenbucket
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SlidingWindowLog implements the sliding window log algorithm
+// Every accepted request is recorded with its timestamp. A request is allowed
+// if the requests logged within the trailing window plus n do not exceed limit.
+//
+// Exact, with no boundary bursts, but memory is O(limit) per key.
+type SlidingWindowLog struct {
+	mu     sync.Mutex
+	logs   map[string][]logEntry
+	limit  int           // Max requests per trailing window
+	window time.Duration // Length of the trailing window
+	clock  Clock
+}
+
+type logEntry struct {
+	at time.Time
+	n  int // Cost of the request, so AllowN does not need n entries
+}
+
+// NewSlidingWindowLog creates a sliding window log rate limiter allowing limit requests per window
+func NewSlidingWindowLog(limit int, window time.Duration, opts ...Option) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		logs:   make(map[string][]logEntry),
+		limit:  limit,
+		window: window,
+		clock:  buildOptions(opts).clock,
+	}
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (sw *SlidingWindowLog) Allow(key string) bool {
+	return sw.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (sw *SlidingWindowLog) AllowN(key string, n int) bool {
+	return sw.AllowWithInfo(key, n).Allowed
+}
+
+// Reset clears the rate limit state for a key
+func (sw *SlidingWindowLog) Reset(key string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	delete(sw.logs, key)
+}
+
+// Refund removes n units from the newest log entries
+func (sw *SlidingWindowLog) Refund(key string, n int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	entries := sw.logs[key]
+	for n > 0 && len(entries) > 0 {
+		last := &entries[len(entries)-1]
+		if last.n > n {
+			last.n -= n
+			break
+		}
+		n -= last.n
+		entries = entries[:len(entries)-1]
+	}
+	if len(entries) == 0 {
+		delete(sw.logs, key)
+	} else {
+		sw.logs[key] = entries
+	}
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+func (sw *SlidingWindowLog) AllowWithInfo(key string, n int) *Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.clock.Now()
+	cutoff := now.Add(-sw.window)
+
+	// Drop entries that have slid out of the window (log is sorted by time)
+	entries := sw.logs[key]
+	expired := 0
+	for expired < len(entries) && !entries[expired].at.After(cutoff) {
+		expired++
+	}
+	entries = entries[expired:]
+
+	used := 0
+	for _, e := range entries {
+		used += e.n
+	}
+
+	allowed := used+n <= sw.limit
+	if allowed && n > 0 {
+		entries = append(entries, logEntry{at: now, n: n})
+		used += n
+	}
+	if len(entries) == 0 {
+		delete(sw.logs, key)
+	} else {
+		sw.logs[key] = entries
+	}
+
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     sw.limit,
+		Remaining: sw.limit - used,
+		ResetAt:   now,
+	}
+	if len(entries) > 0 {
+		// Full capacity once the newest entry slides out
+		result.ResetAt = entries[len(entries)-1].at.Add(sw.window)
+	}
+	if !allowed {
+		// Wait until enough of the oldest entries expire to fit n
+		result.RetryAfter = result.ResetAt.Sub(now)
+		freed := 0
+		for _, e := range entries {
+			freed += e.n
+			if used-freed+n <= sw.limit {
+				result.RetryAfter = e.at.Add(sw.window).Sub(now)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// SlidingWindowCounter implements the sliding window counter algorithm
+// Only the counts of the current and previous fixed windows are kept. The number
+// of requests in the trailing window is estimated by weighting the previous
+// window's count by how much of it still overlaps the trailing window:
+//
+//	estimate = previous * (1 - elapsed/window) + current
+//
+// O(1) memory per key and smooths the fixed window boundary burst,
+// at the cost of assuming requests in the previous window were evenly spread.
+type SlidingWindowCounter struct {
+	mu       sync.Mutex
+	counters map[string]*windowCounter
+	limit    int           // Max requests per trailing window
+	window   time.Duration // Length of each window
+	clock    Clock
+}
+
+type windowCounter struct {
+	start    time.Time // Start of the current window
+	previous int
+	current  int
+}
+
+// NewSlidingWindowCounter creates a sliding window counter rate limiter allowing limit requests per window
+func NewSlidingWindowCounter(limit int, window time.Duration, opts ...Option) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		counters: make(map[string]*windowCounter),
+		limit:    limit,
+		window:   window,
+		clock:    buildOptions(opts).clock,
+	}
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (sc *SlidingWindowCounter) Allow(key string) bool {
+	return sc.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (sc *SlidingWindowCounter) AllowN(key string, n int) bool {
+	return sc.AllowWithInfo(key, n).Allowed
+}
+
+// Reset clears the rate limit state for a key
+func (sc *SlidingWindowCounter) Reset(key string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.counters, key)
+}
+
+// Refund removes n requests from the current window's count
+func (sc *SlidingWindowCounter) Refund(key string, n int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	c, exists := sc.counters[key]
+	if !exists || sc.clock.Now().Sub(c.start) >= sc.window {
+		return
+	}
+	c.current = max(c.current-n, 0)
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+func (sc *SlidingWindowCounter) AllowWithInfo(key string, n int) *Result {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := sc.clock.Now()
+	c, exists := sc.counters[key]
+	if !exists {
+		c = &windowCounter{start: now}
+		sc.counters[key] = c
+	} else if elapsed := now.Sub(c.start); elapsed >= sc.window {
+		// Roll the windows forward. If more than one window passed, the
+		// previous window is empty.
+		windows := elapsed / sc.window
+		if windows == 1 {
+			c.previous = c.current
+		} else {
+			c.previous = 0
+		}
+		c.current = 0
+		c.start = c.start.Add(windows * sc.window)
+	}
+
+	elapsed := now.Sub(c.start)
+	weight := 1 - float64(elapsed)/float64(sc.window)
+	estimate := float64(c.previous)*weight + float64(c.current)
+
+	allowed := estimate+float64(n) <= float64(sc.limit)
+	if allowed {
+		c.current += n
+		estimate += float64(n)
+	}
+
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     sc.limit,
+		Remaining: int(math.Max(float64(sc.limit)-estimate, 0)),
+		ResetAt:   c.start.Add(sc.window),
+	}
+	if c.current > 0 {
+		// The current window still weighs on the estimate during the next one
+		result.ResetAt = c.start.Add(2 * sc.window)
+	}
+	if !allowed {
+		result.RetryAfter = sc.retryAfter(c, n, elapsed)
+	}
+	return result
+}
+
+// Compute how long until the estimate has room for n more requests
+func (sc *SlidingWindowCounter) retryAfter(c *windowCounter, n int, elapsed time.Duration) time.Duration {
+	window := float64(sc.window)
+
+	// Case 1: waiting for the previous window's weight to decay is enough
+	// Solve previous * (1 - e/window) + current + n <= limit for e
+	room := float64(sc.limit - c.current - n)
+	if room >= 0 && c.previous > 0 {
+		e := window * (1 - room/float64(c.previous))
+		return time.Duration(math.Ceil(e)) - elapsed
+	}
+
+	// Case 2: wait for the next window, then for the current count to decay
+	// Solve current * (1 - e/window) + n <= limit for e
+	untilNext := sc.window - elapsed
+	if n > sc.limit || c.current == 0 {
+		return untilNext
+	}
+	e := window * (1 - float64(sc.limit-n)/float64(c.current))
+	return untilNext + time.Duration(math.Ceil(math.Max(e, 0)))
+}
@@ -0,0 +1,114 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowLog_ExpiresOldestFirst(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewSlidingWindowLog(4, 200*time.Millisecond, WithClock(clock))
+	key := "user:alice"
+
+	limiter.AllowN(key, 2)
+	clock.Advance(100 * time.Millisecond)
+	limiter.AllowN(key, 2)
+
+	result := limiter.AllowWithInfo(key, 1)
+	if result.Allowed {
+		t.Fatal("Should be denied with a full log")
+	}
+	// Only the first entry has to expire
+	if result.RetryAfter != 100*time.Millisecond {
+		t.Errorf("RetryAfter should wait for the oldest entry only, got %v", result.RetryAfter)
+	}
+	if want := epoch.Add(300 * time.Millisecond); !result.ResetAt.Equal(want) {
+		t.Errorf("Expected reset when the newest entry expires (%v), got %v", want, result.ResetAt)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	if !limiter.AllowN(key, 2) {
+		t.Error("Oldest entry expired, 2 requests should be allowed")
+	}
+	if limiter.Allow(key) {
+		t.Error("Second entry is still in the window")
+	}
+}
+
+func TestSlidingWindowLog_NoBoundaryBurst(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewSlidingWindowLog(5, 200*time.Millisecond, WithClock(clock))
+	key := "user:bob"
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow(key)
+	}
+	// A fixed window could reset here; the trailing window still holds all 5
+	clock.Advance(199 * time.Millisecond)
+	if limiter.Allow(key) {
+		t.Error("Requests inside the trailing window should still count")
+	}
+}
+
+func TestSlidingWindowCounter_WeightsPreviousWindow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewSlidingWindowCounter(10, 200*time.Millisecond, WithClock(clock))
+	key := "user:charlie"
+
+	for i := 0; i < 10; i++ {
+		limiter.Allow(key)
+	}
+
+	// A quarter into the next window the previous window still weighs 75%,
+	// so only 10 - 7.5 = 2.5 -> 2 requests fit, not the whole quota
+	clock.Advance(250 * time.Millisecond)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow(key) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected 2 requests allowed, got %d", allowed)
+	}
+}
+
+func TestSlidingWindowCounter_RetryAfter(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewSlidingWindowCounter(10, time.Second, WithClock(clock))
+	key := "user:eve"
+
+	limiter.AllowN(key, 10)
+	clock.Advance(time.Second)
+
+	// Estimate is 10 * 1.0 + 0: 4 requests fit once the previous weight drops to 0.6
+	result := limiter.AllowWithInfo(key, 4)
+	if result.Allowed {
+		t.Fatal("Should be denied at the start of the next window")
+	}
+	if result.RetryAfter != 400*time.Millisecond {
+		t.Errorf("Expected RetryAfter 400ms, got %v", result.RetryAfter)
+	}
+
+	clock.Advance(result.RetryAfter)
+	if !limiter.AllowN(key, 4) {
+		t.Error("Request should be allowed after RetryAfter")
+	}
+}
+
+func TestSlidingWindowCounter_ForgetsOldWindows(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewSlidingWindowCounter(5, 100*time.Millisecond, WithClock(clock))
+	key := "user:david"
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow(key)
+	}
+
+	// Two full windows later the old count no longer matters
+	clock.Advance(200 * time.Millisecond)
+	result := limiter.AllowWithInfo(key, 5)
+	if !result.Allowed {
+		t.Error("Full quota should be available after two windows")
+	}
+}
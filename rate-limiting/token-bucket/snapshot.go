@@ -0,0 +1,263 @@
+package tokenbucket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot format, all integers big-endian or varint:
+//
+//	magic     "TBSN"
+//	version   byte (1)
+//	count     uvarint
+//	count × {
+//	    key        uvarint length + bytes
+//	    tokens     float64 bits (8 bytes, may be negative after Reserve)
+//	    lastRefill varint unix nanoseconds
+//	}
+//	crc32     IEEE checksum of everything above (4 bytes)
+const (
+	snapshotMagic   = "TBSN"
+	snapshotVersion = 1
+)
+
+// ErrBadSnapshot is returned by Restore for data that is not a valid snapshot
+var ErrBadSnapshot = errors.New("tokenbucket: invalid snapshot")
+
+// Snapshot writes the state of every bucket to w
+// Restoring it after a restart keeps throttled clients throttled instead of
+// handing everyone a fresh burst on every deploy.
+func (tb *TokenBucket) Snapshot(w io.Writer) error {
+	return writeSnapshot(w, tb.snapshotEntries())
+}
+
+// Copy the state of every bucket under the lock, encoding happens without it
+func (tb *TokenBucket) snapshotEntries() []snapshotEntry {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	entries := make([]snapshotEntry, 0, len(tb.buckets))
+	for key, b := range tb.buckets {
+		entries = append(entries, snapshotEntry{key: key, tokens: b.tokens, lastRefill: b.lastRefill})
+	}
+	return entries
+}
+
+func writeSnapshot(w io.Writer, entries []snapshotEntry) error {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	buf.WriteByte(snapshotVersion)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(entries))))
+	for _, e := range entries {
+		entry := binary.AppendUvarint(nil, uint64(len(e.key)))
+		entry = append(entry, e.key...)
+		entry = binary.BigEndian.AppendUint64(entry, math.Float64bits(e.tokens))
+		entry = binary.AppendVarint(entry, e.lastRefill.UnixNano())
+		buf.Write(entry)
+	}
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+type snapshotEntry struct {
+	key        string
+	tokens     float64
+	lastRefill time.Time
+}
+
+// Restore loads bucket state written by Snapshot
+// Restored keys replace any current state for the same keys, other keys are
+// kept. Buckets keep their recorded last refill time, so the next request
+// credits the refill for the downtime, capped at the key's burst size.
+// Nothing is applied unless the whole snapshot is valid.
+func (tb *TokenBucket) Restore(r io.Reader) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	tb.restoreEntries(entries)
+	return nil
+}
+
+// Apply restored entries, replacing the current state of their keys
+func (tb *TokenBucket) restoreEntries(entries []snapshotEntry) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.clock.Now()
+	for _, e := range entries {
+		// Policies may have changed since the snapshot was taken
+		tokens := math.Min(e.tokens, float64(tb.policyFor(e.key).BurstSize))
+		// Don't let a clock that moved backwards postpone the refill
+		lastRefill := e.lastRefill
+		if lastRefill.After(now) {
+			lastRefill = now
+		}
+		tb.remove(e.key)
+		tb.insert(e.key, &bucket{tokens: tokens, lastRefill: lastRefill})
+	}
+}
+
+func readSnapshot(r io.Reader) ([]snapshotEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(snapshotMagic) + 1
+	if len(data) < headerLen+4 {
+		return nil, fmt.Errorf("%w: too short", ErrBadSnapshot)
+	}
+	if string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrBadSnapshot)
+	}
+	if version := data[len(snapshotMagic)]; version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, version)
+	}
+	body, trailer := data[:len(data)-4], data[len(data)-4:]
+	if binary.BigEndian.Uint32(trailer) != crc32.ChecksumIEEE(body) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	br := bytes.NewReader(body[headerLen:])
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	var entries []snapshotEntry
+	for i := uint64(0); i < count; i++ {
+		e, err := readSnapshotEntry(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %v", ErrBadSnapshot, i, err)
+		}
+		entries = append(entries, e)
+	}
+	if br.Len() != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrBadSnapshot)
+	}
+	return entries, nil
+}
+
+func readSnapshotEntry(br *bytes.Reader) (snapshotEntry, error) {
+	keyLen, err := binary.ReadUvarint(br)
+	if err != nil {
+		return snapshotEntry{}, err
+	}
+	if keyLen > uint64(br.Len()) {
+		return snapshotEntry{}, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, keyLen+8)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return snapshotEntry{}, err
+	}
+	nanos, err := binary.ReadVarint(br)
+	if err != nil {
+		return snapshotEntry{}, err
+	}
+	return snapshotEntry{
+		key:        string(buf[:keyLen]),
+		tokens:     math.Float64frombits(binary.BigEndian.Uint64(buf[keyLen:])),
+		lastRefill: time.Unix(0, nanos),
+	}, nil
+}
+
+// SnapshotFile writes a snapshot to path atomically
+// The snapshot goes to a temporary file in the same directory which is
+// synced and renamed over path, so a crash never leaves a torn snapshot.
+func (tb *TokenBucket) SnapshotFile(path string) error {
+	return writeFileAtomic(path, tb.Snapshot)
+}
+
+// Write to a synced temporary file next to path and rename it over path
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// RestoreFile restores a snapshot written by SnapshotFile
+// A missing file returns an error matching fs.ErrNotExist, which callers
+// usually ignore on first start.
+func (tb *TokenBucket) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tb.Restore(f)
+}
+
+// SnapshotErr returns the error of the last periodic snapshot, nil if it succeeded
+func (tb *TokenBucket) SnapshotErr() error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.snapshotErr
+}
+
+// Write a snapshot to tb.snapshotPath every interval until Close is called
+func (tb *TokenBucket) snapshotter(interval time.Duration) {
+	defer tb.background.Done()
+	snapshotEvery(tb.clock, interval, tb.stop, func() {
+		err := tb.SnapshotFile(tb.snapshotPath)
+		tb.mu.Lock()
+		tb.snapshotErr = err
+		tb.mu.Unlock()
+	})
+}
+
+// Call snapshot every interval until stop is closed
+func snapshotEvery(clock Clock, interval time.Duration, stop <-chan struct{}, snapshot func()) {
+	for {
+		timer := clock.NewTimer(interval)
+		select {
+		case <-timer.C():
+			snapshot()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Start the periodic snapshotter based on options
+func (tb *TokenBucket) startSnapshots(o options) {
+	if o.snapshotPath == "" {
+		return
+	}
+	tb.snapshotPath = o.snapshotPath
+	if o.snapshotInterval > 0 {
+		if tb.stop == nil {
+			tb.stop = make(chan struct{})
+		}
+		tb.background.Add(1)
+		go tb.snapshotter(o.snapshotInterval)
+	}
+}
@@ -0,0 +1,246 @@
+package tokenbucket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_SnapshotRestore(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	limiter.AllowN("user:alice", 10)
+	limiter.AllowN("user:bob", 4)
+	limiter.Reserve("user:carol", 10)
+	limiter.Reserve("user:carol", 5) // Negative balance survives too
+
+	var buf bytes.Buffer
+	if err := limiter.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	if err := restarted.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Allow("user:alice") {
+		t.Error("Restored empty bucket should deny")
+	}
+	if result := restarted.AllowWithInfo("user:bob", 0); result.Remaining != 6 {
+		t.Errorf("Expected bob's 6 tokens restored, got %d", result.Remaining)
+	}
+	if result := restarted.AllowWithInfo("user:carol", 1); result.RetryAfter != 600*time.Millisecond {
+		t.Errorf("Expected carol's debt restored, got RetryAfter %v", result.RetryAfter)
+	}
+	if stats := restarted.Stats(); stats.Keys != 3 {
+		t.Errorf("Expected 3 keys, got %d", stats.Keys)
+	}
+}
+
+func TestTokenBucket_RestoreCreditsDowntime(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	limiter.AllowN("user:alice", 10)
+
+	var buf bytes.Buffer
+	limiter.Snapshot(&buf)
+
+	// Down for 300ms: 3 tokens refilled in the meantime
+	clock.Advance(300 * time.Millisecond)
+	restarted := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	if err := restarted.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if result := restarted.AllowWithInfo("user:alice", 0); result.Remaining != 3 {
+		t.Errorf("Expected 3 tokens after 300ms downtime, got %d", result.Remaining)
+	}
+}
+
+func TestTokenBucket_RestoreClampsToPolicy(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(100, time.Second, 100, WithClock(clock))
+	limiter.AllowN("user:alice", 1)
+
+	var buf bytes.Buffer
+	limiter.Snapshot(&buf)
+
+	// Restarted with a smaller burst and a clock that is behind
+	clock.Set(epoch.Add(-time.Hour))
+	restarted := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	restarted.Restore(&buf)
+	if result := restarted.AllowWithInfo("user:alice", 0); result.Remaining != 10 {
+		t.Errorf("Expected tokens capped at the new burst 10, got %d", result.Remaining)
+	}
+}
+
+func TestTokenBucket_RestoreInvalid(t *testing.T) {
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(NewFakeClock(epoch)))
+	limiter.AllowN("user:alice", 5)
+	var buf bytes.Buffer
+	limiter.Snapshot(&buf)
+	valid := buf.Bytes()
+
+	corrupt := func(i int) []byte {
+		data := bytes.Clone(valid)
+		data[i] ^= 0xff
+		return data
+	}
+	tests := map[string][]byte{
+		"empty":     nil,
+		"magic":     corrupt(0),
+		"version":   corrupt(4),
+		"checksum":  corrupt(len(valid) - 1),
+		"body":      corrupt(8),
+		"truncated": valid[:len(valid)-6],
+	}
+	for name, data := range tests {
+		restarted := NewTokenBucket(10, time.Second, 10)
+		if err := restarted.Restore(bytes.NewReader(data)); !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("%s: expected ErrBadSnapshot, got %v", name, err)
+		}
+		if stats := restarted.Stats(); stats.Keys != 0 {
+			t.Errorf("%s: invalid snapshot should not be applied", name)
+		}
+	}
+}
+
+func TestTokenBucket_SnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limiter.snap")
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	limiter.AllowN("user:alice", 10)
+
+	if err := limiter.SnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	if err := restarted.RestoreFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Allow("user:alice") {
+		t.Error("Restored bucket should be empty")
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file, got %d entries", len(entries))
+	}
+	if err := restarted.RestoreFile(path + ".missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestTokenBucket_PeriodicSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limiter.snap")
+	clock := NewFakeClock(epoch)
+	limiter := NewTokenBucket(10, time.Second, 10, WithClock(clock), WithSnapshotFile(path, time.Minute))
+	limiter.AllowN("user:alice", 3)
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1) // Snapshotter is waiting for the next interval
+	if err := limiter.SnapshotErr(); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	if err := restored.RestoreFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if stats := restored.Stats(); stats.Keys != 1 {
+		t.Errorf("Expected 1 key in periodic snapshot, got %d", stats.Keys)
+	}
+
+	// Close writes a final snapshot
+	limiter.AllowN("user:bob", 1)
+	if err := limiter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	restored = NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	restored.RestoreFile(path)
+	if stats := restored.Stats(); stats.Keys != 2 {
+		t.Errorf("Expected 2 keys in final snapshot, got %d", stats.Keys)
+	}
+}
+
+func TestShardedTokenBucket_SnapshotRestore(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 8, WithClock(clock))
+	for i := 0; i < 20; i++ {
+		limiter.AllowN(fmt.Sprintf("user:%d", i), i%10+1)
+	}
+
+	var buf bytes.Buffer
+	if err := limiter.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Any shard count, or a plain TokenBucket, can load it
+	resharded := NewShardedTokenBucket(10, time.Second, 10, 3, WithClock(clock))
+	if err := resharded.Restore(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	single := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	if err := single.Restore(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		want := 10 - (i%10 + 1)
+		if result := resharded.AllowWithInfo(key, 0); result.Remaining != want {
+			t.Errorf("Resharded %s: expected %d tokens, got %d", key, want, result.Remaining)
+		}
+		if result := single.AllowWithInfo(key, 0); result.Remaining != want {
+			t.Errorf("Single %s: expected %d tokens, got %d", key, want, result.Remaining)
+		}
+	}
+	if stats := resharded.Stats(); stats.Keys != 20 {
+		t.Errorf("Expected 20 keys, got %d", stats.Keys)
+	}
+	if err := resharded.Restore(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, ErrBadSnapshot) {
+		t.Errorf("Expected ErrBadSnapshot, got %v", err)
+	}
+}
+
+func TestShardedTokenBucket_PeriodicSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "limiter.snap")
+	clock := NewFakeClock(epoch)
+	limiter := NewShardedTokenBucket(10, time.Second, 10, 4, WithClock(clock), WithSnapshotFile(path, time.Minute))
+	for i := 0; i < 10; i++ {
+		limiter.AllowN(fmt.Sprintf("user:%d", i), 3)
+	}
+
+	// Only the sharded limiter's snapshotter runs, not one per shard
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	if err := limiter.SnapshotErr(); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	if err := restored.RestoreFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if stats := restored.Stats(); stats.Keys != 10 {
+		t.Errorf("Expected all 10 keys in the snapshot, got %d", stats.Keys)
+	}
+
+	limiter.AllowN("user:late", 1)
+	if err := limiter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	restored = NewTokenBucket(10, time.Second, 10, WithClock(clock))
+	restored.RestoreFile(path)
+	if stats := restored.Stats(); stats.Keys != 11 {
+		t.Errorf("Expected 11 keys in final snapshot, got %d", stats.Keys)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,228 @@
+package tokenbucket
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// BucketState is the per-key token bucket state kept in a Store
+type BucketState struct {
+	Tokens     float64
+	LastRefill time.Time
+}
+
+// Store holds per-key bucket state outside the limiter, e.g. in Redis so
+// several replicas of a service share one quota instead of each granting it.
+//
+// Implementations must make Update atomic per key: no other Update for the
+// same key may interleave between reading the state and writing it back.
+type Store interface {
+	// Update reads the state for key and calls fn with it (found is false if
+	// there is none). If fn returns true the modified state is written back and
+	// expires after ttl. fn may be called more than once if the store retries
+	// on conflict, so it must not have side effects beyond the state.
+	Update(key string, ttl time.Duration, fn func(state *BucketState, found bool) bool) error
+
+	// Delete removes the state for key
+	Delete(key string) error
+}
+
+// StoreTokenBucket is a token bucket limiter whose state lives in a Store
+// The refill-and-consume logic is the same as TokenBucket; the store only
+// guarantees that it runs atomically per key.
+//
+// The Limiter methods can't return errors, so a store failure denies the
+// request (fail closed) unless WithFailOpen is set. Use Take to see errors.
+// All replicas sharing a store should have reasonably synchronized clocks.
+type StoreTokenBucket struct {
+	store     Store
+	rate      int           // Tokens per window
+	burstSize int           // Max tokens in bucket
+	window    time.Duration // Time window for rate
+	clock     Clock
+	failOpen  bool
+}
+
+// NewStoreTokenBucket creates a token bucket limiter backed by store
+func NewStoreTokenBucket(store Store, rate int, window time.Duration, burstSize int, opts ...Option) *StoreTokenBucket {
+	// Default burst size to rate if not specified
+	if burstSize == 0 {
+		burstSize = rate
+	}
+	o := buildOptions(opts)
+	return &StoreTokenBucket{
+		store:     store,
+		rate:      rate,
+		burstSize: burstSize,
+		window:    window,
+		clock:     o.clock,
+		failOpen:  o.failOpen,
+	}
+}
+
+// Take refills the bucket for key and consumes n tokens if available
+// Returns the store's error if the state could not be read or written.
+func (s *StoreTokenBucket) Take(key string, n int) (*Result, error) {
+	now := s.clock.Now()
+	refillRate := float64(s.rate) / s.window.Seconds()
+
+	var result *Result
+	err := s.store.Update(key, s.ttl(), func(state *BucketState, found bool) bool {
+		if !found {
+			// First request for key -> full bucket
+			state.Tokens = float64(s.burstSize)
+		} else {
+			elapsed := now.Sub(state.LastRefill)
+			if elapsed < 0 {
+				// Another replica's clock is ahead of ours
+				elapsed = 0
+			}
+			state.Tokens = math.Min(state.Tokens+refillRate*elapsed.Seconds(), float64(s.burstSize))
+		}
+		// Never move the refill time back, or a replica whose clock is ahead
+		// would be credited the skew again as refill
+		if now.After(state.LastRefill) {
+			state.LastRefill = now
+		}
+
+		allowed := float64(n) <= state.Tokens
+		if allowed {
+			state.Tokens -= float64(n)
+		}
+		result = s.buildResult(state, allowed, n, now)
+
+		// A denied request leaves the stored state valid: refill is a pure
+		// function of time, so there is nothing worth writing back
+		return allowed
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Time for an empty bucket to refill completely, after which the state
+// is indistinguishable from a missing key and the store may drop it
+func (s *StoreTokenBucket) ttl() time.Duration {
+	return time.Duration(float64(s.burstSize) / float64(s.rate) * float64(s.window))
+}
+
+// Build a result given the state after the check
+func (s *StoreTokenBucket) buildResult(state *BucketState, allowed bool, requestedTokens int, now time.Time) *Result {
+	refillRate := float64(s.rate) / s.window.Seconds()
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     s.burstSize,
+		Remaining: int(state.Tokens),
+	}
+	if !allowed {
+		tokensNeeded := float64(requestedTokens) - state.Tokens
+		result.RetryAfter = time.Duration(tokensNeeded * float64(time.Second) / refillRate)
+	}
+	tokensToFull := float64(s.burstSize) - state.Tokens
+	result.ResetAt = now.Add(time.Duration(tokensToFull * float64(time.Second) / refillRate))
+	return result
+}
+
+// Allow checks if a single request should be allowed for the given key
+func (s *StoreTokenBucket) Allow(key string) bool {
+	return s.AllowN(key, 1)
+}
+
+// AllowN checks if N requests should be allowed
+func (s *StoreTokenBucket) AllowN(key string, n int) bool {
+	return s.AllowWithInfo(key, n).Allowed
+}
+
+// AllowWithInfo returns detailed information about the rate limit check
+// On a store error the result is a denial (or an allow with WithFailOpen)
+func (s *StoreTokenBucket) AllowWithInfo(key string, n int) *Result {
+	result, err := s.Take(key, n)
+	if err != nil {
+		return &Result{Allowed: s.failOpen, Limit: s.burstSize}
+	}
+	return result
+}
+
+// Reset clears the rate limit state for a key
+// Store errors are ignored, use the store's Delete directly to see them
+func (s *StoreTokenBucket) Reset(key string) {
+	s.store.Delete(key)
+}
+
+// Refund returns n tokens to the stored bucket for key
+// Store errors are ignored, the tokens are simply lost
+func (s *StoreTokenBucket) Refund(key string, n int) {
+	now := s.clock.Now()
+	refillRate := float64(s.rate) / s.window.Seconds()
+	s.store.Update(key, s.ttl(), func(state *BucketState, found bool) bool {
+		if !found {
+			return false
+		}
+		elapsed := max(now.Sub(state.LastRefill), 0)
+		state.Tokens = min(state.Tokens+refillRate*elapsed.Seconds()+float64(n), float64(s.burstSize))
+		if now.After(state.LastRefill) {
+			state.LastRefill = now
+		}
+		return true
+	})
+}
+
+// MemoryStore is an in-process Store, mainly useful for tests and single
+// instance deployments that want to share code with a distributed setup
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	clock   Clock
+}
+
+type memoryEntry struct {
+	state     BucketState
+	expiresAt time.Time // Zero for no expiry
+}
+
+// NewMemoryStore creates an empty in-process store
+// Only the WithClock option applies, it is used for expiry
+func NewMemoryStore(opts ...Option) *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		clock:   buildOptions(opts).clock,
+	}
+}
+
+// Update applies fn to the state for key under the store's lock
+func (m *MemoryStore) Update(key string, ttl time.Duration, fn func(state *BucketState, found bool) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	var state BucketState
+	e, found := m.entries[key]
+	if found && !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+		// Expired entries are removed lazily
+		delete(m.entries, key)
+		found = false
+	}
+	if found {
+		state = e.state
+	}
+
+	if !fn(&state, found) {
+		return nil
+	}
+	e = &memoryEntry{state: state}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	m.entries[key] = e
+	return nil
+}
+
+// Delete removes the state for key
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
@@ -0,0 +1,121 @@
+package tokenbucket
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreTokenBucket_SharedStore(t *testing.T) {
+	// Two replicas sharing one store grant the quota once, not twice
+	clock := NewFakeClock(epoch)
+	store := NewMemoryStore(WithClock(clock))
+	replicaA := NewStoreTokenBucket(store, 10, time.Second, 10, WithClock(clock))
+	replicaB := NewStoreTokenBucket(store, 10, time.Second, 10, WithClock(clock))
+	key := "user:alice"
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if replicaA.Allow(key) {
+			allowed++
+		}
+		if replicaB.Allow(key) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("Expected 10 requests allowed across replicas, got %d", allowed)
+	}
+
+	clock.Advance(300 * time.Millisecond)
+	result, err := replicaB.Take(key, 3)
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected 3 refilled tokens to be used up, got %+v", result)
+	}
+}
+
+func TestStoreTokenBucket_SkewedClocks(t *testing.T) {
+	// Replica A's clock runs a second ahead of replica B's
+	clockA := NewFakeClock(epoch.Add(time.Second))
+	clockB := NewFakeClock(epoch)
+	store := NewMemoryStore(WithClock(clockB))
+	replicaA := NewStoreTokenBucket(store, 10, time.Second, 10, WithClock(clockA))
+	replicaB := NewStoreTokenBucket(store, 10, time.Second, 10, WithClock(clockB))
+	key := "user:alice"
+
+	if !replicaA.AllowN(key, 5) || !replicaB.AllowN(key, 5) {
+		t.Fatal("Expected the burst to be shared between the replicas")
+	}
+	// No time has passed on either clock, so nothing has refilled
+	if replicaA.Allow(key) {
+		t.Error("Clock skew should not be credited as refill")
+	}
+
+	replicaB.Refund(key, 2)
+	if result := replicaA.AllowWithInfo(key, 0); result.Remaining != 2 {
+		t.Errorf("Expected only the 2 refunded tokens, got %d", result.Remaining)
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	store := NewMemoryStore(WithClock(clock))
+	limiter := NewStoreTokenBucket(store, 10, time.Second, 10, WithClock(clock))
+
+	limiter.Allow("user:bob")
+	if len(store.entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(store.entries))
+	}
+
+	// TTL is the time to refill from empty: 1s
+	clock.Advance(time.Second)
+	found := true
+	store.Update("user:bob", 0, func(state *BucketState, ok bool) bool {
+		found = ok
+		return false
+	})
+	if found {
+		t.Error("Entry should have expired after the refill time")
+	}
+}
+
+func TestStoreTokenBucket_DeniedRequestsDontWrite(t *testing.T) {
+	store := NewMemoryStore()
+	limiter := NewStoreTokenBucket(store, 10, time.Second, 10)
+
+	limiter.AllowN("user:charlie", 11)
+	if len(store.entries) != 0 {
+		t.Error("Denied first request should not create state")
+	}
+}
+
+// Store that always fails
+type failingStore struct{}
+
+var errStoreDown = errors.New("store down")
+
+func (failingStore) Update(string, time.Duration, func(*BucketState, bool) bool) error {
+	return errStoreDown
+}
+
+func (failingStore) Delete(string) error {
+	return errStoreDown
+}
+
+func TestStoreTokenBucket_StoreErrors(t *testing.T) {
+	closed := NewStoreTokenBucket(failingStore{}, 10, time.Second, 10)
+	if closed.Allow("user:dave") {
+		t.Error("Store failure should deny by default")
+	}
+	if _, err := closed.Take("user:dave", 1); !errors.Is(err, errStoreDown) {
+		t.Errorf("Take should return the store error, got %v", err)
+	}
+
+	open := NewStoreTokenBucket(failingStore{}, 10, time.Second, 10, WithFailOpen())
+	if !open.Allow("user:dave") {
+		t.Error("Store failure should allow with WithFailOpen")
+	}
+}
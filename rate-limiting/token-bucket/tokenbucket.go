@@ -1,6 +1,7 @@
 package tokenbucket
 
 import (
+	"container/list"
 	"math"
 	"sync"
 	"time"
@@ -14,30 +15,53 @@ import (
 // The key identifies WHO is being rate limited (user ID, API key, IP address, etc.)
 // Each key maintains independent state - users don't share buckets.
 type TokenBucket struct {
-	mu        sync.Mutex
-	buckets   map[string]*bucket // Key is bucket state
-	rate      int                // Tokens per window
-	burstSize int                // Max tokens in bucket
-	window    time.Duration      // Time window for rate
+	mu       sync.Mutex
+	buckets  map[string]*bucket // Key is bucket state
+	clock    Clock              // Time source, see clock.go
+	observer Observer           // Notified of decisions (nil = none), see observer.go
+
+	// Rate configuration, see policy.go
+	policy    Policy            // Default for keys without an override
+	overrides map[string]Policy // Exact key overrides
+	prefixes  []prefixPolicy    // "prefix*" overrides, longest prefix first
+
+	// Eviction, see eviction.go
+	idleTTL   time.Duration // Evict full buckets idle this long (0 = never)
+	maxKeys   int           // Cap on tracked keys (0 = unbounded)
+	lru       *list.List    // Keys, most recently used first (nil without maxKeys)
+	evicted   uint64        // Total buckets evicted
+	stop      chan struct{} // Closed to stop the janitor and snapshotter
+	closeOnce sync.Once
+
+	// Periodic snapshots, see snapshot.go
+	snapshotPath string
+	snapshotErr  error          // Result of the last periodic snapshot
+	background   sync.WaitGroup // Janitor and snapshotter goroutines
+
+	ticketTTL time.Duration // How long Acquire tickets stay open, see settle.go
 }
 
 type bucket struct {
 	tokens     float64
 	lastRefill time.Time
+	elem       *list.Element // Position in the LRU list (nil without maxKeys)
 }
 
 // NewTokenBucket creates a new token bucket rate limiter
-func NewTokenBucket(rate int, window time.Duration, burstSize int) *TokenBucket {
-	// Default burst size to rate if not specified
-	if burstSize == 0 {
-		burstSize = rate
-	}
-	return &TokenBucket{
+// See options.go for optional behavior such as idle eviction
+func NewTokenBucket(rate int, window time.Duration, burstSize int, opts ...Option) *TokenBucket {
+	tb := &TokenBucket{
 		buckets:   make(map[string]*bucket),
-		rate:      rate,
-		burstSize: burstSize,
-		window:    window,
+		policy:    NewPolicy(rate, window, burstSize),
+		overrides: make(map[string]Policy),
 	}
+	o := buildOptions(opts)
+	tb.clock = o.clock
+	tb.observer = o.observer
+	tb.ticketTTL = o.ticketTTL
+	tb.startEviction(o)
+	tb.startSnapshots(o)
+	return tb
 }
 
 // Allow checks if a request should be allowed for the given key using one token
@@ -49,37 +73,22 @@ func (tb *TokenBucket) Allow(key string) bool {
 
 // AllowN checks if N requests should be allowed
 func (tb *TokenBucket) AllowN(key string, n int) bool {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
-
-	// Get current tokens and last refill time from storage
-	b, exists := tb.buckets[key]
-	if !exists {
-		// Check that n is in bounds of burstSize
-		if n <= tb.burstSize {
-			// First request for key -> create bucket with full tokens minus n
-			tb.buckets[key] = &bucket{
-				tokens:     float64(tb.burstSize - n),
-				lastRefill: time.Now(),
-			}
-			return true
-		}
-		// Requested more than bucket capacity
-		return false
+	if tb.observer != nil {
+		// Observers need the full result
+		return tb.AllowWithInfo(key, n).Allowed
 	}
 
-	// Calculate tokens to add based on time elapsed
-	elapsed := time.Since(b.lastRefill)
-	refillRate := float64(tb.rate) / tb.window.Seconds()
-	tokensToAdd := refillRate * elapsed.Seconds()
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
 
-	// Refill tokens (up to bucket capacity = burst size)
-	b.tokens = math.Min(b.tokens+tokensToAdd, float64(tb.burstSize))
-	b.lastRefill = time.Now()
+	b, _, exists := tb.refill(key, tb.clock.Now())
 
 	// Check and consume
 	if float64(n) <= b.tokens {
 		b.tokens -= float64(n)
+		if !exists {
+			tb.insert(key, b)
+		}
 		return true
 	}
 
@@ -87,25 +96,55 @@ func (tb *TokenBucket) AllowN(key string, n int) bool {
 	return false
 }
 
+// Look up the bucket for key and refill it for the time elapsed until now
+// A key seen for the first time gets a full bucket, which is only stored
+// once tokens are consumed from it (denied requests don't allocate state)
+// Also returns the policy in effect for key
+func (tb *TokenBucket) refill(key string, now time.Time) (*bucket, Policy, bool) {
+	p := tb.policyFor(key)
+	b, exists := tb.buckets[key]
+	if !exists {
+		return &bucket{
+			tokens:     float64(p.BurstSize),
+			lastRefill: now,
+		}, p, false
+	}
+
+	p.refill(b, now)
+	tb.touch(b)
+	return b, p, true
+}
+
 // Reset clears the rate limit state for a key
 func (tb *TokenBucket) Reset(key string) {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
-	delete(tb.buckets, key)
+	tb.remove(key)
 }
 
-// Build a result given a bucket, whether it is allowed, and requested tokens
-func (tb *TokenBucket) buildResult(b *bucket, allowed bool, requestedTokens int) *Result {
-	if b == nil {
-		// No bucket!
-		return &Result{Allowed: false, Remaining: 0}
+// Refund returns n tokens to the bucket for key
+func (tb *TokenBucket) Refund(key string, n int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	b, p, exists := tb.refill(key, tb.clock.Now())
+	if !exists {
+		// A missing bucket is already full
+		return
 	}
+	b.tokens = min(b.tokens+float64(n), float64(p.BurstSize))
+}
 
+// Build a result given a bucket, whether it is allowed, and requested tokens
+func (tb *TokenBucket) buildResult(b *bucket, p Policy, allowed bool, requestedTokens int, now time.Time) *Result {
 	result := &Result{
-		Allowed:   allowed,
-		Remaining: int(b.tokens),
+		Allowed: allowed,
+		Limit:   p.BurstSize,
+		// Tokens can be negative while reservations are outstanding
+		Remaining: int(math.Max(b.tokens, 0)),
+		Debt:      int(math.Ceil(math.Max(-b.tokens, 0))),
 	}
-	refillRate := float64(tb.rate) / tb.window.Seconds()
+	refillRate := p.refillRate()
 
 	// Calculate RetryAfter if denied
 	if !allowed {
@@ -114,8 +153,8 @@ func (tb *TokenBucket) buildResult(b *bucket, allowed bool, requestedTokens int)
 	}
 
 	// Calculate ResetAt = when bucket is full
-	tokensToFull := float64(tb.burstSize) - b.tokens
-	result.ResetAt = time.Now().Add(time.Duration(tokensToFull * float64(time.Second) / refillRate))
+	tokensToFull := float64(p.BurstSize) - b.tokens
+	result.ResetAt = now.Add(time.Duration(tokensToFull * float64(time.Second) / refillRate))
 
 	return result
 }
@@ -123,41 +162,29 @@ func (tb *TokenBucket) buildResult(b *bucket, allowed bool, requestedTokens int)
 // AllowWithInfo returns detailed information about the rate limit check
 // Return Result with Allowed, Remaining, RetryAfter, ResetAt fields
 func (tb *TokenBucket) AllowWithInfo(key string, n int) *Result {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
-
-	// Get current tokens and last refill time from storage
-	b, exists := tb.buckets[key]
-	if !exists {
-		// Check that n is in bounds of burstSize
-		allowed := false
-		if n <= tb.burstSize {
-			// First request for key -> create bucket with full tokens minus n
-			tb.buckets[key] = &bucket{
-				tokens:     float64(tb.burstSize - n),
-				lastRefill: time.Now(),
-			}
-			allowed = true
-		}
-
-		return tb.buildResult(tb.buckets[key], allowed, n)
+	result := tb.allowWithInfo(key, n)
+	if tb.observer != nil {
+		tb.observer.Observe(key, n, result)
 	}
+	return result
+}
 
-	// Calculate tokens to add based on time elapsed
-	elapsed := time.Since(b.lastRefill)
-	refillRate := float64(tb.rate) / tb.window.Seconds()
-	tokensToAdd := refillRate * elapsed.Seconds()
+func (tb *TokenBucket) allowWithInfo(key string, n int) *Result {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
 
-	// Refill tokens (up to bucket capacity = burst size)
-	b.tokens = math.Min(b.tokens+tokensToAdd, float64(tb.burstSize))
-	b.lastRefill = time.Now()
+	now := tb.clock.Now()
+	b, p, exists := tb.refill(key, now)
 
 	// Check and consume
 	allowed := false
 	if float64(n) <= b.tokens {
 		b.tokens -= float64(n)
 		allowed = true
+		if !exists {
+			tb.insert(key, b)
+		}
 	}
 
-	return tb.buildResult(b, allowed, n)
+	return tb.buildResult(b, p, allowed, n, now)
 }